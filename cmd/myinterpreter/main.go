@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/codecrafters-io/interpreter-starter-go/internal/errorHand"
 	"github.com/codecrafters-io/interpreter-starter-go/internal/interpreter"
@@ -17,30 +18,40 @@ func main() {
 	// You can use print statements as follows for debugging, they'll be visible when running tests.
 	fmt.Fprintln(os.Stderr, "Logs from your program will appear here!")
 
-	if len(os.Args) < 3 && len(os.Args) != 2 {
-		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh <command> <filename> or ./your_program.sh <filename>")
+	args, format, err := splitFormatFlag(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh <command> [--format=text|json] <filename>")
 		os.Exit(1)
 	}
 
-	command := os.Args[1]
+	command := args[0]
 
 	if !isCommandRight(command) {
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
 		os.Exit(1)
 	}
+	if format == "json" && command != "tokenize" && command != "parse" {
+		fmt.Fprintf(os.Stderr, "--format=json is only supported by tokenize and parse\n")
+		os.Exit(1)
+	}
 
-	fileName := os.Args[2]
+	fileName := args[1]
 	fileContents, err := os.ReadFile(fileName)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
 		os.Exit(1)
 	}
 
-	if len(fileContents) > 0 {
+	if len(fileContents) > 0 || format == "json" {
 		scan := scanner.NewScanner(fileContents)
 		tokens = scan.Scan(fileContents)
 		par := parser.NewParser(tokens)
-		var expr *parser.Node
+		var expr parser.Expr
 
 		switch command {
 		case "run":
@@ -49,23 +60,47 @@ func main() {
 				os.Exit(65)
 			}
 			inter := interpreter.NewStmtInterpreter(stmt)
-			inter.ExecuteStmts()
+			inter.Resolve()
+			if errorHand.HadError {
+				os.Exit(65)
+			}
+			err := inter.ExecuteStmts()
+			if err != nil {
+				reportRuntimeError(err)
+				os.Exit(70)
+			}
 		case "tokenize":
-			scanner.PrintTokens(tokens)
-		default:
+			if format == "json" {
+				scanner.PrintTokensJSON(os.Stdout, tokens)
+			} else {
+				scanner.PrintTokens(tokens)
+			}
+		case "parse":
+			stmts := par.ParseProgram()
+			if errorHand.HadError {
+				os.Exit(65)
+			}
+			if format == "json" {
+				parser.PrintASTJSON(os.Stdout, stmts)
+			} else {
+				parser.AstPrintStmts(stmts)
+			}
+		default: // command to evaluate
 			expr = par.ParseExpr()
-			if command == "parse" {
-				if !errorHand.HadError {
-					parser.AstPrint(expr)
-				}
-			} else { // command to evaluate
-				inter := interpreter.NewExprInterpreter(expr)
-				result, err := inter.Interpret()
-				if err != nil {
-					os.Exit(70)
-				}
-				fmt.Println(result)
+			if errorHand.HadError {
+				os.Exit(65)
+			}
+			inter := interpreter.NewExprInterpreter(expr)
+			inter.Resolve()
+			if errorHand.HadError {
+				os.Exit(65)
 			}
+			result, err := inter.Interpret()
+			if err != nil {
+				reportRuntimeError(err)
+				os.Exit(70)
+			}
+			fmt.Println(result)
 		}
 	} else {
 		fmt.Println("EOF  null")
@@ -76,6 +111,43 @@ func main() {
 	}
 }
 
+// reportRuntimeError prints the message followed by one "[line N]" entry per
+// active Lox call, innermost first, naming the function each line belongs to.
+func reportRuntimeError(err error) {
+	runtimeErr, ok := err.(*interpreter.RuntimeError)
+	if !ok {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, runtimeErr.Message)
+	line := runtimeErr.Token.Line
+	for _, frame := range runtimeErr.Stack {
+		fmt.Fprintf(os.Stderr, "[line %d] in %s()\n", line, frame.Function)
+		line = frame.CallLine
+	}
+	fmt.Fprintf(os.Stderr, "[line %d]\n", line)
+}
+
+// splitFormatFlag takes the --format=text|json flag out of args, wherever it
+// is, and returns the remaining arguments along with the format.
+func splitFormatFlag(args []string) ([]string, string, error) {
+	format := "text"
+	var rest []string
+	for _, arg := range args {
+		value, found := strings.CutPrefix(arg, "--format=")
+		if !found {
+			rest = append(rest, arg)
+			continue
+		}
+		if value != "text" && value != "json" {
+			return nil, "", fmt.Errorf("Unknown format: %s", value)
+		}
+		format = value
+	}
+	return rest, format, nil
+}
+
 func isCommandRight(command string) bool {
 	return command == "tokenize" || command == "parse" || command == "evaluate" || command == "run"
 }
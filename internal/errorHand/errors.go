@@ -12,8 +12,14 @@ func Error(line int, message string) {
 	ReportError(line, message)
 }
 
+// ParseError reports a syntax error found at token; an empty token means the
+// error is at the end of the file.
 func ParseError(token string, line int, message string) {
-	message = "Error at " + "'" + token + "': " + message
+	if token == "" {
+		message = "Error at end: " + message
+	} else {
+		message = "Error at " + "'" + token + "': " + message
+	}
 	ReportError(line, message)
 }
 
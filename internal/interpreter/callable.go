@@ -0,0 +1,150 @@
+package interpreter
+
+import (
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// callable is a function, class or native. paren is the closing
+// parenthesis of the call, where runtime errors are reported.
+type callable interface {
+	arity() int
+	call(s *stmtInterpreter, paren scanner.Token, args []Value) (Value, error)
+}
+
+// returnValue is the error a return statement unwinds with, up to the
+// function call that is running it. It never reaches the user.
+type returnValue struct {
+	value Value
+}
+
+func (r returnValue) Error() string {
+	return "return outside of a function call"
+}
+
+// loxFunction is both named functions and lambdas; name is empty for the
+// latter.
+type loxFunction struct {
+	name          string
+	params        []scanner.Token
+	body          []parser.Statement
+	closure       *environment
+	isInitializer bool
+}
+
+func (f *loxFunction) arity() int {
+	return len(f.params)
+}
+
+func (f *loxFunction) call(s *stmtInterpreter, paren scanner.Token, args []Value) (Value, error) {
+	env := newEnclosedEnvironment(f.closure)
+	for i, param := range f.params {
+		env.define(param.Lexeme, args[i])
+	}
+
+	var value Value = nil
+	err := s.executeBlock(f.body, env)
+	if err != nil {
+		ret, ok := err.(returnValue)
+		if !ok {
+			return nil, err
+		}
+		value = ret.value
+	}
+	if f.isInitializer {
+		return f.closure.values["this"], nil
+	}
+	return value, nil
+}
+
+// bind returns a copy of the method whose closure has "this" set to instance.
+func (f *loxFunction) bind(instance *loxInstance) *loxFunction {
+	env := newEnclosedEnvironment(f.closure)
+	env.define("this", instance)
+	return &loxFunction{
+		name:          f.name,
+		params:        f.params,
+		body:          f.body,
+		closure:       env,
+		isInitializer: f.isInitializer,
+	}
+}
+
+func callableName(function callable) string {
+	switch f := function.(type) {
+	case *loxFunction:
+		if f.name == "" {
+			return "anonymous"
+		}
+		return f.name
+	case *loxClass:
+		return f.name
+	case *nativeFunction:
+		return f.name
+	}
+	return "?"
+}
+
+type loxClass struct {
+	name       string
+	superclass *loxClass
+	methods    map[string]*loxFunction
+}
+
+// findMethod walks up the superclass chain until it finds the method.
+func (c *loxClass) findMethod(name string) *loxFunction {
+	method, ok := c.methods[name]
+	if ok {
+		return method
+	}
+	if c.superclass != nil {
+		return c.superclass.findMethod(name)
+	}
+	return nil
+}
+
+func (c *loxClass) arity() int {
+	initializer := c.findMethod("init")
+	if initializer == nil {
+		return 0
+	}
+	return initializer.arity()
+}
+
+// call creates a new instance and runs init on it, if the class has one.
+func (c *loxClass) call(s *stmtInterpreter, paren scanner.Token, args []Value) (Value, error) {
+	instance := &loxInstance{class: c, fields: make(map[string]Value)}
+	initializer := c.findMethod("init")
+	if initializer != nil {
+		_, err := initializer.bind(instance).call(s, paren, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return instance, nil
+}
+
+type loxInstance struct {
+	class  *loxClass
+	fields map[string]Value
+}
+
+// get looks the property up in the fields first and then in the class
+// methods, which come back bound to the instance.
+func (i *loxInstance) get(name scanner.Token) (Value, error) {
+	value, ok := i.fields[name.Lexeme]
+	if ok {
+		return value, nil
+	}
+
+	method := i.class.findMethod(name.Lexeme)
+	if method != nil {
+		return method.bind(i), nil
+	}
+
+	return nil, newRuntimeError(name, "Undefined property '"+name.Lexeme+"'.")
+}
+
+func (i *loxInstance) set(name scanner.Token, value Value) {
+	i.fields[name.Lexeme] = value
+}
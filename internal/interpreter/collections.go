@@ -0,0 +1,186 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// loxList is a reference type: every variable holding the list sees the
+// changes made through any of them.
+type loxList struct {
+	elements []Value
+}
+
+// loxMap keeps its keys in insertion order, so iterating and printing it is
+// deterministic. Keys are strings or numbers.
+type loxMap struct {
+	keys   []Value
+	values map[Value]Value
+}
+
+func newLoxMap() *loxMap {
+	return &loxMap{keys: nil, values: make(map[Value]Value)}
+}
+
+// NewList returns a Lox list holding a copy of elements, for natives to
+// return. Every element has to be a Value.
+func NewList(elements []Value) (Value, error) {
+	for _, element := range elements {
+		if !isValue(element) {
+			return nil, fmt.Errorf("A Go %T is not a Lox value.", element)
+		}
+	}
+	return &loxList{elements: append([]Value(nil), elements...)}, nil
+}
+
+// ListElements returns a copy of the elements of a Lox list, or false if
+// value is not a list.
+func ListElements(value Value) ([]Value, bool) {
+	list, ok := value.(*loxList)
+	if !ok {
+		return nil, false
+	}
+	return append([]Value(nil), list.elements...), true
+}
+
+// NewMap returns a Lox map with keys[i] set to values[i], in that order,
+// for natives to return. Keys have to be strings or numbers and values
+// have to be Values.
+func NewMap(keys []Value, values []Value) (Value, error) {
+	if len(keys) != len(values) {
+		return nil, errors.New("A map needs as many keys as values.")
+	}
+	m := newLoxMap()
+	for i, key := range keys {
+		if !isValue(values[i]) {
+			return nil, fmt.Errorf("A Go %T is not a Lox value.", values[i])
+		}
+		err := m.set(key, values[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// MapEntries returns the keys of a Lox map in insertion order along with
+// their values, or false if value is not a map.
+func MapEntries(value Value) (keys []Value, values []Value, ok bool) {
+	m, ok := value.(*loxMap)
+	if !ok {
+		return nil, nil, false
+	}
+	values = make([]Value, len(m.keys))
+	for i, key := range m.keys {
+		values[i] = m.values[key]
+	}
+	return append([]Value(nil), m.keys...), values, true
+}
+
+func (m *loxMap) get(key Value) (Value, error) {
+	value, ok := m.values[key]
+	if !ok {
+		return nil, errors.New("Undefined key '" + stringify(key) + "'.")
+	}
+	return value, nil
+}
+
+// set adds a new key at the end, or replaces the value of an existing key
+// keeping its position.
+func (m *loxMap) set(key Value, value Value) error {
+	switch key.(type) {
+	case string, float64:
+	default:
+		return errors.New("Map keys must be strings or numbers.")
+	}
+
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+	return nil
+}
+
+// delete removes key, reporting whether it was in the map.
+func (m *loxMap) delete(key Value) bool {
+	if _, ok := m.values[key]; !ok {
+		return false
+	}
+	delete(m.values, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// listIndex checks that index is a whole number in [0, length) and returns
+// it as an int.
+func listIndex(index Value, length int) (int, error) {
+	n, ok := index.(float64)
+	if !ok || n != math.Trunc(n) {
+		return 0, errors.New("List index must be an integer.")
+	}
+	if n < 0 || n >= float64(length) {
+		return 0, errors.New("List index out of range.")
+	}
+	return int(n), nil
+}
+
+func isIndexable(object Value) bool {
+	switch object.(type) {
+	case *loxList, *loxMap:
+		return true
+	}
+	return false
+}
+
+// indexGet reads object[index], reporting errors at bracket.
+func indexGet(bracket scanner.Token, object Value, index Value) (Value, error) {
+	var value Value
+	var err error
+	switch collection := object.(type) {
+	case *loxList:
+		var i int
+		i, err = listIndex(index, len(collection.elements))
+		if err == nil {
+			value = collection.elements[i]
+		}
+	case *loxMap:
+		value, err = collection.get(index)
+	default:
+		return nil, newRuntimeError(bracket, "Only lists and maps can be indexed.")
+	}
+
+	if err != nil {
+		return nil, newRuntimeError(bracket, err.Error())
+	}
+	return value, nil
+}
+
+// indexSet writes object[index] = value, reporting errors at bracket.
+func indexSet(bracket scanner.Token, object Value, index Value, value Value) error {
+	var err error
+	switch collection := object.(type) {
+	case *loxList:
+		var i int
+		i, err = listIndex(index, len(collection.elements))
+		if err == nil {
+			collection.elements[i] = value
+		}
+	case *loxMap:
+		err = collection.set(index, value)
+	default:
+		return newRuntimeError(bracket, "Only lists and maps can be indexed.")
+	}
+
+	if err != nil {
+		return newRuntimeError(bracket, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package interpreter
+
+import (
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// RuntimeError is returned when a Lox program fails while running. Token is
+// where the error was raised and Stack holds the Lox calls that were active
+// at that point, innermost first.
+type RuntimeError struct {
+	Token   scanner.Token
+	Message string
+	Stack   []Frame
+}
+
+// Frame is a call to Function made from line CallLine of its caller.
+type Frame struct {
+	Function string
+	CallLine int
+}
+
+func newRuntimeError(token scanner.Token, message string) *RuntimeError {
+	return &RuntimeError{
+		Token:   token,
+		Message: message,
+		Stack:   nil,
+	}
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Message
+}
@@ -3,332 +3,953 @@ package interpreter
 import (
 	"errors"
 	"fmt"
-	"os"
+	"math"
 	"strconv"
 	"strings"
 
-	"github.com/codecrafters-io/interpreter-starter-go/internal/errorHand"
 	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
 	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
 )
 
 type exprInterpreter struct {
-	expr *parser.Node
+	expr        parser.Expr
+	interpreter stmtInterpreter
 }
 
 type stmtInterpreter struct {
 	stmts       []parser.Statement
+	globals     *environment
 	Environment *environment
+	// locals holds, for every use of a local variable, how many
+	// environments up from the current one it is declared. Uses that are
+	// not in it are globals. The resolver fills it in.
+	locals    map[parser.Expr]int
+	callDepth int
 }
 
+// maxCallDepth bounds how deeply Lox calls can nest, so runaway recursion
+// is a runtime error instead of overflowing the Go stack.
+const maxCallDepth = 10000
+
 /******************************************************************************/
 type environment struct {
-	values    map[string]result
+	values map[string]Value
+	// constants is only made once a constant is defined, as most
+	// environments never hold one.
+	constants map[string]bool
 	enclosing *environment
 }
 
 func newEnvironment() *environment {
 	return &environment{
-		values:    make(map[string]result),
+		values:    make(map[string]Value),
 		enclosing: nil,
 	}
 }
 
-func (e *environment) define(name string, value result) {
+func newEnclosedEnvironment(enclosing *environment) *environment {
+	return &environment{
+		values:    make(map[string]Value),
+		enclosing: enclosing,
+	}
+}
+
+func (e *environment) define(name string, value Value) {
+	e.values[name] = value
+	delete(e.constants, name)
+}
+
+// defineConst defines a variable that assign refuses to change.
+func (e *environment) defineConst(name string, value Value) {
 	e.values[name] = value
+	if e.constants == nil {
+		e.constants = make(map[string]bool)
+	}
+	e.constants[name] = true
 }
 
-func (e *environment) get(name string) result {
-	value, ok := e.values[name]
+func (e *environment) get(name scanner.Token) (Value, error) {
+	value, ok := e.values[name.Lexeme]
 	if ok {
-		return value
+		return value, nil
 	}
 	if e.enclosing != nil {
 		return e.enclosing.get(name)
 	}
-	errorHand.Error(0, "Undefined variable '"+name+"'.")
-	return result{}
+	return nil, newRuntimeError(name, "Undefined variable '"+name.Lexeme+"'.")
+}
+
+// ancestor returns the environment distance steps up the chain.
+func (e *environment) ancestor(distance int) *environment {
+	env := e
+	for i := 0; i < distance; i++ {
+		env = env.enclosing
+	}
+	return env
 }
 
-func (e *environment) assign(name scanner.Token, value result) {
+// getAt reads a variable the resolver found distance environments up.
+func (e *environment) getAt(distance int, name string) Value {
+	return e.ancestor(distance).values[name]
+}
+
+// assignAt writes a variable the resolver found distance environments up.
+func (e *environment) assignAt(distance int, name scanner.Token, value Value) error {
+	env := e.ancestor(distance)
+	if env.constants[name.Lexeme] {
+		return newRuntimeError(name, "Can't reassign constant '"+name.Lexeme+"'.")
+	}
+	env.values[name.Lexeme] = value
+	return nil
+}
+
+func (e *environment) assign(name scanner.Token, value Value) error {
 	_, ok := e.values[name.Lexeme]
 	if ok {
+		if e.constants[name.Lexeme] {
+			return newRuntimeError(name, "Can't reassign constant '"+name.Lexeme+"'.")
+		}
 		e.values[name.Lexeme] = value
-		return
+		return nil
 	}
 	if e.enclosing != nil {
-		e.enclosing.assign(name, value)
-		return
+		return e.enclosing.assign(name, value)
 	}
-	errorHand.Error(0, "Undefined variable '"+name.Lexeme+"'.")
+	return newRuntimeError(name, "Undefined variable '"+name.Lexeme+"'.")
 }
 
 /******************************************************************************/
 
-type result struct {
-	Value     string
-	valueType scanner.TokenType
+// Value is any runtime value of a Lox program: nil, bool, float64, string,
+// a callable (function, class or native), an *loxInstance, a list or a map.
+// Go code builds lists and maps with NewList and NewMap.
+type Value = interface{}
+
+// isValue tells whether value is one of the kinds of Value, as opposed to
+// some other Go value a native might return.
+func isValue(value Value) bool {
+	switch value.(type) {
+	case nil, bool, float64, string, *loxFunction, *nativeFunction, *loxClass,
+		*loxInstance, *loxList, *loxMap:
+		return true
+	}
+	return false
 }
 
-func NewExprInterpreter(expr *parser.Node) *exprInterpreter {
-	return &exprInterpreter{expr: expr}
+func NewExprInterpreter(expr parser.Expr) *exprInterpreter {
+	return &exprInterpreter{expr: expr, interpreter: NewStmtInterpreter(nil)}
 }
 
 func NewStmtInterpreter(stmts []parser.Statement) stmtInterpreter {
-	return stmtInterpreter{
+	globals := newEnvironment()
+	s := stmtInterpreter{
 		stmts:       stmts,
-		Environment: newEnvironment(),
+		globals:     globals,
+		Environment: globals,
+		locals:      make(map[parser.Expr]int),
 	}
+	s.defineNatives()
+	return s
+}
+
+// RegisterNative defines a native function the expression can call. It has
+// to be called before Interpret.
+func (inter *exprInterpreter) RegisterNative(name string, arity int, function NativeFunc) {
+	inter.interpreter.RegisterNative(name, arity, function)
 }
 
 func (inter *exprInterpreter) Interpret() (string, error) {
-	result, err := evaluate(inter.expr)
-	return result.Value, err
+	value, err := inter.interpreter.evaluate(inter.expr)
+	if err != nil {
+		return "", err
+	}
+	return stringify(value), nil
 }
 
-func (s *stmtInterpreter) ExecuteStmts() {
+func (s *stmtInterpreter) ExecuteStmts() error {
 	for _, stmt := range s.stmts {
-		switch stmt.StmtType() {
-		case parser.PRINT:
-			stmt.Execute(func() {
-				s.executePrintStmt(stmt)
-			})
-		case parser.EXPR:
-			stmt.Execute(func() {
-				s.executeExprStmt(stmt)
-			})
+		err := s.execute(stmt)
+		if err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-func (s *stmtInterpreter) executePrintStmt(stmt parser.Statement) {
-	pStmt, _ := stmt.(parser.PrintStmt)
+func (s *stmtInterpreter) execute(stmt parser.Statement) error {
+	_, err := stmt.Accept(s)
+	return err
+}
 
-	result, err := evaluate(pStmt.Expr)
+func (s *stmtInterpreter) VisitPrintStmt(stmt *parser.PrintStmt) (interface{}, error) {
+	result, err := s.evaluate(stmt.Expr)
 	if err != nil {
-		os.Exit(70)
+		return nil, err
+	}
+	fmt.Println(stringify(result))
+	return nil, nil
+}
+
+func (s *stmtInterpreter) VisitExprStmt(stmt *parser.ExprStmt) (interface{}, error) {
+	_, err := s.evaluate(stmt.Expr)
+	return nil, err
+}
+
+func (s *stmtInterpreter) VisitVarDeclStmt(stmt *parser.VarDeclStmt) (interface{}, error) {
+	var value Value = nil
+	if stmt.Initializer != nil {
+		var err error
+		value, err = s.evaluate(stmt.Initializer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if stmt.Const {
+		s.Environment.defineConst(stmt.Name.Lexeme, value)
+	} else {
+		s.Environment.define(stmt.Name.Lexeme, value)
 	}
-	fmt.Println(result.Value)
+	return nil, nil
+}
+
+func (s *stmtInterpreter) VisitBlockStmt(stmt *parser.BlockStmt) (interface{}, error) {
+	return nil, s.executeBlock(stmt.Statements, newEnclosedEnvironment(s.Environment))
 }
 
-func (s *stmtInterpreter) executeExprStmt(stmt parser.Statement) {
-	eStmt, _ := stmt.(parser.ExprStmt)
-	_, err := evaluate(eStmt.Expr)
+func (s *stmtInterpreter) VisitIfStmt(stmt *parser.IfStmt) (interface{}, error) {
+	condition, err := s.evaluate(stmt.Condition)
 	if err != nil {
-		os.Exit(70)
+		return nil, err
 	}
+
+	if isTruthy(condition) {
+		return nil, s.execute(stmt.ThenBranch)
+	} else if stmt.ElseBranch != nil {
+		return nil, s.execute(stmt.ElseBranch)
+	}
+	return nil, nil
+}
+
+// loopJump is the error break and continue unwind with, up to the loop
+// they target. An empty label targets the innermost loop. It never reaches
+// the user.
+type loopJump struct {
+	isBreak bool
+	label   string
 }
 
-func (s *stmtInterpreter) executeVarStmt(stmt parser.Statement) {
-	vstmt, _ := stmt.(parser.VarDeclStmt)
-	result := result{}
-	if vstmt.Initializer != nil {
-		result, _ = evaluate(vstmt.Initializer)
+func (j loopJump) Error() string {
+	return "break or continue outside of a loop"
+}
+
+// VisitSwitchStmt evaluates the case values in order, stopping at the first
+// one equal to the subject, and runs only that case's body in a new scope.
+func (s *stmtInterpreter) VisitSwitchStmt(stmt *parser.SwitchStmt) (interface{}, error) {
+	subject, err := s.evaluate(stmt.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, clause := range stmt.Cases {
+		for _, valueExpr := range clause.Values {
+			value, err := s.evaluate(valueExpr)
+			if err != nil {
+				return nil, err
+			}
+			if isEqual(subject, value) {
+				return nil, s.executeBlock(clause.Body, newEnclosedEnvironment(s.Environment))
+			}
+		}
+	}
+
+	if stmt.Default != nil {
+		return nil, s.executeBlock(stmt.Default.Body, newEnclosedEnvironment(s.Environment))
 	}
-	s.Environment.define(vstmt.Name.Lexeme, result)
+	return nil, nil
 }
 
-func evaluate(expr *parser.Node) (result, error) {
-	switch expr.ExprType {
-	case parser.BINARY:
-		return evaluateBinary(expr)
-	case parser.GROUPING:
-		return evaluateGrouping(expr)
-	case parser.UNARY:
-		return evaluateUnary(expr)
-	case parser.VARIABLE:
-		return evaluateVariable(expr)
-	default:
-		return evaluateLiteral(expr)
+func (s *stmtInterpreter) VisitWhileStmt(stmt *parser.WhileStmt) (interface{}, error) {
+	for {
+		condition, err := s.evaluate(stmt.Condition)
+		if err != nil {
+			return nil, err
+		}
+		if !isTruthy(condition) {
+			return nil, nil
+		}
+
+		broke, err := s.executeLoopBody(stmt)
+		if err != nil {
+			return nil, err
+		}
+		if broke {
+			return nil, nil
+		}
+
+		if stmt.Increment != nil {
+			_, err = s.evaluate(stmt.Increment)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 }
 
-func evaluateBinary(expr *parser.Node) (result, error) {
-	left, err := evaluate(expr.Left)
-	if err != nil {
-		return result{}, err
+// executeLoopBody runs one iteration of the loop body, stopping the
+// loopJump errors aimed at this loop. It reports whether the body broke out.
+func (s *stmtInterpreter) executeLoopBody(stmt *parser.WhileStmt) (bool, error) {
+	err := s.execute(stmt.Body)
+	if err == nil {
+		return false, nil
 	}
+	jump, ok := err.(loopJump)
+	if !ok || (jump.label != "" && (stmt.Label == nil || stmt.Label.Lexeme != jump.label)) {
+		return false, err
+	}
+	return jump.isBreak, nil
+}
 
-	right, err := evaluate(expr.Right)
-	if err != nil {
-		return result{}, err
+func (s *stmtInterpreter) VisitBreakStmt(stmt *parser.BreakStmt) (interface{}, error) {
+	return nil, loopJump{isBreak: true, label: labelName(stmt.Label)}
+}
+
+func (s *stmtInterpreter) VisitContinueStmt(stmt *parser.ContinueStmt) (interface{}, error) {
+	return nil, loopJump{isBreak: false, label: labelName(stmt.Label)}
+}
+
+func labelName(label *scanner.Token) string {
+	if label == nil {
+		return ""
 	}
+	return label.Lexeme
+}
 
-	var nLeft float64
-	var nRight float64
+func (s *stmtInterpreter) VisitFunctionStmt(stmt *parser.FunctionStmt) (interface{}, error) {
+	function := &loxFunction{
+		name:          stmt.Name.Lexeme,
+		params:        stmt.Params,
+		body:          stmt.Body,
+		closure:       s.Environment,
+		isInitializer: false,
+	}
+	s.Environment.define(stmt.Name.Lexeme, function)
+	return nil, nil
+}
 
-	if areNumbers(left, right) {
-		nLeft, err = strconv.ParseFloat(left.Value, 64)
+func (s *stmtInterpreter) VisitClassStmt(stmt *parser.ClassStmt) (interface{}, error) {
+	var superclass *loxClass = nil
+	if stmt.Superclass != nil {
+		value, err := s.evaluate(stmt.Superclass)
 		if err != nil {
-			panic(err)
+			return nil, err
+		}
+		class, ok := value.(*loxClass)
+		if !ok {
+			return nil, newRuntimeError(stmt.Superclass.Name, "Superclass must be a class.")
+		}
+		superclass = class
+	}
+
+	// methods of a subclass close over an extra environment holding "super"
+	closure := s.Environment
+	if superclass != nil {
+		closure = newEnclosedEnvironment(s.Environment)
+		closure.define("super", superclass)
+	}
+
+	methods := make(map[string]*loxFunction)
+	for _, method := range stmt.Methods {
+		methods[method.Name.Lexeme] = &loxFunction{
+			name:          method.Name.Lexeme,
+			params:        method.Params,
+			body:          method.Body,
+			closure:       closure,
+			isInitializer: method.Name.Lexeme == "init",
 		}
-		nRight, err = strconv.ParseFloat(right.Value, 64)
+	}
+
+	class := &loxClass{name: stmt.Name.Lexeme, superclass: superclass, methods: methods}
+	s.Environment.define(stmt.Name.Lexeme, class)
+	return nil, nil
+}
+
+// VisitReturnStmt unwinds up to the enclosing loxFunction.call with a
+// returnValue error.
+func (s *stmtInterpreter) VisitReturnStmt(stmt *parser.ReturnStmt) (interface{}, error) {
+	var value Value = nil
+	if stmt.Value != nil {
+		var err error
+		value, err = s.evaluate(stmt.Value)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 	}
+	return nil, returnValue{value}
+}
 
-	var res float64
+// executeBlock runs stmts inside env and puts the previous environment back
+// once it finishes, also when a statement returns an error to unwind.
+func (s *stmtInterpreter) executeBlock(stmts []parser.Statement, env *environment) error {
+	previous := s.Environment
+	s.Environment = env
+	for _, stmt := range stmts {
+		err := s.execute(stmt)
+		if err != nil {
+			s.Environment = previous
+			return err
+		}
+	}
+	s.Environment = previous
+	return nil
+}
 
-	switch expr.Value.TokenType {
+func (s *stmtInterpreter) evaluate(expr parser.Expr) (Value, error) {
+	return expr.Accept(s)
+}
+
+func (s *stmtInterpreter) VisitBinaryExpr(expr *parser.BinaryExpr) (interface{}, error) {
+	left, err := s.evaluate(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := s.evaluate(expr.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	return binaryOperation(expr.Operator, expr.Operator.TokenType, left, right)
+}
+
+// compoundOperators maps the compound assignment and increment operators to
+// the binary operator they apply.
+var compoundOperators = map[scanner.TokenType]scanner.TokenType{
+	scanner.PLUS_EQUAL:  scanner.PLUS,
+	scanner.MINUS_EQUAL: scanner.MINUS,
+	scanner.STAR_EQUAL:  scanner.STAR,
+	scanner.SLASH_EQUAL: scanner.SLASH,
+	scanner.PLUS_PLUS:   scanner.PLUS,
+	scanner.MINUS_MINUS: scanner.MINUS,
+}
+
+// binaryOperation applies the binary operator kind to left and right,
+// reporting type errors at operator. kind differs from the type of operator
+// for compound assignments and increments.
+func binaryOperation(operator scanner.Token, kind scanner.TokenType, left, right Value) (Value, error) {
+	switch kind {
 	case scanner.EQUAL_EQUAL:
-		return booleanResult(isEqual(left, right)), nil
+		return isEqual(left, right), nil
 	case scanner.BANG_EQUAL:
-		return booleanResult(!isEqual(left, right)), nil
-	case scanner.MINUS:
-		if !checkAreNumbers(left, right, expr.Value.Line) {
-			return result{}, errors.New("operands must be numbers")
+		return !isEqual(left, right), nil
+	case scanner.PLUS:
+		if lStr, ok := left.(string); ok {
+			if rStr, ok := right.(string); ok {
+				return lStr + rStr, nil
+			}
 		}
-		res = nLeft - nRight
-		return result{formatResultNum(res), scanner.NUMBER}, nil
-	case scanner.STAR:
-		if !checkAreNumbers(left, right, expr.Value.Line) {
-			return result{}, errors.New("operands must be numbers")
+		if lNum, rNum, ok := numberOperands(left, right); ok {
+			return lNum + rNum, nil
 		}
-		res = nLeft * nRight
-		return result{formatResultNum(res), scanner.NUMBER}, nil
+		return nil, newRuntimeError(operator, "Operands must be two numbers or two strings.")
+	}
+
+	nLeft, nRight, ok := numberOperands(left, right)
+	if !ok {
+		return nil, newRuntimeError(operator, "Operands must be numbers.")
+	}
+
+	switch kind {
+	case scanner.MINUS:
+		return nLeft - nRight, nil
+	case scanner.STAR:
+		return nLeft * nRight, nil
 	case scanner.SLASH:
-		if !checkAreNumbers(left, right, expr.Value.Line) {
-			return result{}, errors.New("operands must be numbers")
+		if nRight == 0 {
+			return nil, newRuntimeError(operator, "Division by zero.")
 		}
+		return nLeft / nRight, nil
+	case scanner.PERCENT:
 		if nRight == 0 {
-			errorHand.Error(expr.Value.Line, "Division by zero.")
-			return result{}, errors.New("division by zero")
+			return nil, newRuntimeError(operator, "Division by zero.")
 		}
-		res = nLeft / nRight
-		return result{formatResultNum(res), scanner.NUMBER}, nil
-	case scanner.PLUS:
-		if areStrings(left, right) {
-			return result{left.Value + right.Value, scanner.STRING}, nil
-		} else if areNumbers(left, right) {
-			res = nLeft + nRight
-			return result{formatResultNum(res), scanner.NUMBER}, nil
-		}
-		errorHand.Error(expr.Value.Line, "Operands must be two numbers or two strings.")
-		return result{}, errors.New("operands must be two numbers or two strings")
+		return flooredMod(nLeft, nRight), nil
+	case scanner.STAR_STAR:
+		return math.Pow(nLeft, nRight), nil
 	case scanner.LESS:
-		if !checkAreNumbers(left, right, expr.Value.Line) {
-			return result{}, errors.New("operands must be numbers")
-		}
-		return booleanResult(nLeft < nRight), nil
+		return nLeft < nRight, nil
 	case scanner.LESS_EQUAL:
-		if !checkAreNumbers(left, right, expr.Value.Line) {
-			return result{}, errors.New("operands must be numbers")
-		}
-		return booleanResult(nLeft <= nRight), nil
+		return nLeft <= nRight, nil
 	case scanner.GREATER:
-		if !checkAreNumbers(left, right, expr.Value.Line) {
-			return result{}, errors.New("operands must be numbers")
-		}
-		return booleanResult(nLeft > nRight), nil
+		return nLeft > nRight, nil
 	case scanner.GREATER_EQUAL:
-		if !checkAreNumbers(left, right, expr.Value.Line) {
-			return result{}, errors.New("operands must be numbers")
+		return nLeft >= nRight, nil
+	}
+	return nil, errors.New("error in binary evaluation")
+}
+
+// VisitLogicalExpr only evaluates the right operand when the left one does not
+// already decide the result, and returns the deciding operand itself.
+func (s *stmtInterpreter) VisitLogicalExpr(expr *parser.LogicalExpr) (interface{}, error) {
+	left, err := s.evaluate(expr.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	if expr.Operator.TokenType == scanner.OR {
+		if isTruthy(left) {
+			return left, nil
+		}
+	} else if !isTruthy(left) {
+		return left, nil
+	}
+
+	return s.evaluate(expr.Right)
+}
+
+// VisitConditionalExpr evaluates only the branch the condition selects.
+func (s *stmtInterpreter) VisitConditionalExpr(expr *parser.ConditionalExpr) (interface{}, error) {
+	condition, err := s.evaluate(expr.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	if isTruthy(condition) {
+		return s.evaluate(expr.ThenBranch)
+	}
+	return s.evaluate(expr.ElseBranch)
+}
+
+// VisitFunctionExpr creates a closure over the current environment, the
+// same way a function declaration does.
+func (s *stmtInterpreter) VisitFunctionExpr(expr *parser.FunctionExpr) (interface{}, error) {
+	return &loxFunction{params: expr.Params, body: expr.Body, closure: s.Environment}, nil
+}
+
+func (s *stmtInterpreter) VisitCallExpr(expr *parser.CallExpr) (interface{}, error) {
+	callee, err := s.evaluate(expr.Callee)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]Value, 0, len(expr.Arguments))
+	for _, arg := range expr.Arguments {
+		value, err := s.evaluate(arg)
+		if err != nil {
+			return nil, err
 		}
-		return booleanResult(nLeft >= nRight), nil
+		args = append(args, value)
 	}
-	return result{}, errors.New("error in binary evaluation")
+
+	function, ok := callee.(callable)
+	if !ok {
+		return nil, newRuntimeError(expr.Paren, "Can only call functions and classes.")
+	}
+	return s.call(function, args, expr.Paren)
 }
 
-func evaluateUnary(expr *parser.Node) (result, error) {
-	res, err := evaluate(expr.Right)
+// call checks the arity of function and the call depth, then calls it on
+// behalf of the call closed by paren. A runtime error coming out of it gets
+// the function added to its stack.
+func (s *stmtInterpreter) call(function callable, args []Value, paren scanner.Token) (Value, error) {
+	if len(args) != function.arity() {
+		return nil, newRuntimeError(paren,
+			fmt.Sprintf("Expected %d arguments but got %d.", function.arity(), len(args)))
+	}
 
+	if s.callDepth >= maxCallDepth {
+		return nil, newRuntimeError(paren, "Stack overflow.")
+	}
+	s.callDepth++
+	value, err := function.call(s, paren, args)
+	s.callDepth--
 	if err != nil {
-		return result{}, err
+		runtimeErr, ok := err.(*RuntimeError)
+		if !ok {
+			// natives report plain Go errors, raised here at the call site
+			return nil, newRuntimeError(paren, err.Error())
+		}
+		runtimeErr.Stack = append(runtimeErr.Stack, Frame{
+			Function: callableName(function),
+			CallLine: paren.Line,
+		})
+		return nil, runtimeErr
 	}
+	return value, nil
+}
 
-	if expr.Value.TokenType == scanner.MINUS {
-		if res.valueType != scanner.NUMBER {
-			errorHand.Error(expr.Value.Line, "Operand must be a number.")
-			return result{}, errors.New("operand must be a number")
+func (s *stmtInterpreter) VisitGetExpr(expr *parser.GetExpr) (interface{}, error) {
+	object, err := s.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, ok := object.(*loxInstance)
+	if !ok {
+		return nil, newRuntimeError(expr.Name, "Only instances have properties.")
+	}
+	return instance.get(expr.Name)
+}
+
+func (s *stmtInterpreter) VisitSetExpr(expr *parser.SetExpr) (interface{}, error) {
+	object, err := s.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, ok := object.(*loxInstance)
+	if !ok {
+		return nil, newRuntimeError(expr.Name, "Only instances have fields.")
+	}
+
+	value, err := s.evaluate(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+	instance.set(expr.Name, value)
+	return value, nil
+}
+
+func (s *stmtInterpreter) VisitListExpr(expr *parser.ListExpr) (interface{}, error) {
+	elements := make([]Value, 0, len(expr.Elements))
+	for _, element := range expr.Elements {
+		value, err := s.evaluate(element)
+		if err != nil {
+			return nil, err
 		}
+		elements = append(elements, value)
+	}
+	return &loxList{elements: elements}, nil
+}
 
-		if res.Value[0] == '-' {
-			return result{res.Value[1:], scanner.NUMBER}, nil
+// VisitMapExpr evaluates the entries left to right; a repeated key keeps its
+// first position and its last value.
+func (s *stmtInterpreter) VisitMapExpr(expr *parser.MapExpr) (interface{}, error) {
+	m := newLoxMap()
+	for i, keyExpr := range expr.Keys {
+		key, err := s.evaluate(keyExpr)
+		if err != nil {
+			return nil, err
+		}
+		value, err := s.evaluate(expr.Values[i])
+		if err != nil {
+			return nil, err
 		}
-		return result{"-" + res.Value, scanner.NUMBER}, nil
+		err = m.set(key, value)
+		if err != nil {
+			return nil, newRuntimeError(expr.Brace, err.Error())
+		}
+	}
+	return m, nil
+}
+
+func (s *stmtInterpreter) VisitIndexExpr(expr *parser.IndexExpr) (interface{}, error) {
+	object, err := s.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
 	}
 
-	return booleanResult(!isTruthy(res.Value)), nil
+	index, err := s.evaluate(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+	return indexGet(expr.Bracket, object, index)
 }
 
-func evaluateVariable(expr *parser.Node) (result, error) {
-	return result{}, nil
+func (s *stmtInterpreter) VisitIndexSetExpr(expr *parser.IndexSetExpr) (interface{}, error) {
+	object, err := s.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	if !isIndexable(object) {
+		return nil, newRuntimeError(expr.Bracket, "Only lists and maps can be indexed.")
+	}
+
+	index, err := s.evaluate(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+	value, err := s.evaluate(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	err = indexSet(expr.Bracket, object, index, value)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
 }
 
-func evaluateLiteral(expr *parser.Node) (result, error) {
-	switch expr.Value.TokenType {
-	case scanner.TRUE:
-		return result{"true", scanner.TRUE}, nil
-	case scanner.FALSE:
-		return result{"false", scanner.FALSE}, nil
-	case scanner.NIL:
-		return result{"nil", scanner.NIL}, nil
-	case scanner.STRING:
-		return result{expr.Value.Literal, scanner.STRING}, nil
-	case scanner.NUMBER:
-		return result{evaluateNumber(expr.Value.Literal), scanner.NUMBER}, nil
+// VisitCompoundAssignExpr evaluates the target once, then applies the
+// operator to its current value and Value and stores the result back.
+func (s *stmtInterpreter) VisitCompoundAssignExpr(expr *parser.CompoundAssignExpr) (interface{}, error) {
+	target, err := s.resolvePlace(expr.Target)
+	if err != nil {
+		return nil, err
 	}
-	return result{}, errors.New("should not happend")
+
+	current, err := target.get()
+	if err != nil {
+		return nil, err
+	}
+	value, err := s.evaluate(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := binaryOperation(expr.Operator, compoundOperators[expr.Operator.TokenType], current, value)
+	if err != nil {
+		return nil, err
+	}
+	return result, target.set(result)
+}
+
+// VisitIncrementExpr adds or subtracts one from the target, returning the
+// new value for the prefix form and the old one for the postfix form.
+func (s *stmtInterpreter) VisitIncrementExpr(expr *parser.IncrementExpr) (interface{}, error) {
+	target, err := s.resolvePlace(expr.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := target.get()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := binaryOperation(expr.Operator, compoundOperators[expr.Operator.TokenType], current, 1.0)
+	if err != nil {
+		return nil, err
+	}
+	err = target.set(result)
+	if err != nil {
+		return nil, err
+	}
+
+	if expr.Prefix {
+		return result, nil
+	}
+	return current, nil
 }
 
-func evaluateGrouping(expr *parser.Node) (result, error) {
-	return evaluate(expr.Left)
+// place is an assignment target whose object and index have already been
+// evaluated, so it can be read and then written without evaluating them
+// twice.
+type place struct {
+	get func() (Value, error)
+	set func(value Value) error
 }
 
-func evaluateNumber(number string) string {
-	if strings.Contains(number, ".") {
-		if endsWith(number, ".0") {
-			return number[:len(number)-2]
+func (s *stmtInterpreter) resolvePlace(target parser.Expr) (place, error) {
+	switch t := target.(type) {
+	case *parser.VariableExpr:
+		return place{
+			get: func() (Value, error) { return s.lookUpVariable(t.Name, t) },
+			set: func(value Value) error { return s.assignVariable(t.Name, t, value) },
+		}, nil
+	case *parser.GetExpr:
+		object, err := s.evaluate(t.Object)
+		if err != nil {
+			return place{}, err
 		}
+		instance, ok := object.(*loxInstance)
+		if !ok {
+			return place{}, newRuntimeError(t.Name, "Only instances have fields.")
+		}
+		return place{
+			get: func() (Value, error) { return instance.get(t.Name) },
+			set: func(value Value) error {
+				instance.set(t.Name, value)
+				return nil
+			},
+		}, nil
+	case *parser.IndexExpr:
+		object, err := s.evaluate(t.Object)
+		if err != nil {
+			return place{}, err
+		}
+		index, err := s.evaluate(t.Index)
+		if err != nil {
+			return place{}, err
+		}
+		return place{
+			get: func() (Value, error) { return indexGet(t.Bracket, object, index) },
+			set: func(value Value) error { return indexSet(t.Bracket, object, index, value) },
+		}, nil
 	}
-	return number
+	return place{}, errors.New("invalid assignment target")
 }
 
-func formatResultNum(number float64) string {
-	truncRes := int64(number)
-	if number > float64(truncRes) {
-		return fmt.Sprintf("%g", number)
+// VisitSuperExpr looks the method up starting at the superclass of the class
+// the running method was declared in, and binds it to the current "this".
+func (s *stmtInterpreter) VisitSuperExpr(expr *parser.SuperExpr) (interface{}, error) {
+	// "this" is in the environment bind creates, right inside the one
+	// holding "super"
+	distance := s.locals[expr]
+	superclass, _ := s.Environment.getAt(distance, "super").(*loxClass)
+	object := s.Environment.getAt(distance-1, "this")
+
+	method := superclass.findMethod(expr.Method.Lexeme)
+	if method == nil {
+		return nil, newRuntimeError(expr.Method, "Undefined property '"+expr.Method.Lexeme+"'.")
 	}
-	return fmt.Sprintf("%.0f", number)
+	return method.bind(object.(*loxInstance)), nil
 }
 
-func isTruthy(value string) bool {
-	if value == "nil" || value == "false" {
-		return false
+func (s *stmtInterpreter) VisitUnaryExpr(expr *parser.UnaryExpr) (interface{}, error) {
+	right, err := s.evaluate(expr.Right)
+
+	if err != nil {
+		return nil, err
 	}
-	return true
+
+	if expr.Operator.TokenType == scanner.MINUS {
+		number, ok := right.(float64)
+		if !ok {
+			return nil, newRuntimeError(expr.Operator, "Operand must be a number.")
+		}
+		return -number, nil
+	}
+
+	return !isTruthy(right), nil
 }
 
-func endsWith(text, patrn string) bool {
-	pl := len(patrn)
-	endtxt := len(text)
-	return text[endtxt-pl:] == patrn
+func (s *stmtInterpreter) VisitVariableExpr(expr *parser.VariableExpr) (interface{}, error) {
+	return s.lookUpVariable(expr.Name, expr)
 }
 
-func areNumbers(left, right result) bool {
-	return left.valueType == scanner.NUMBER && right.valueType == scanner.NUMBER
+func (s *stmtInterpreter) VisitAssignExpr(expr *parser.AssignExpr) (interface{}, error) {
+	value, err := s.evaluate(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+	err = s.assignVariable(expr.Name, expr, value)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// lookUpVariable reads name in the environment the resolver bound expr to,
+// or in the globals if it is not a local.
+func (s *stmtInterpreter) lookUpVariable(name scanner.Token, expr parser.Expr) (Value, error) {
+	distance, ok := s.locals[expr]
+	if ok {
+		return s.Environment.getAt(distance, name.Lexeme), nil
+	}
+	return s.globals.get(name)
+}
+
+// assignVariable is the assignment counterpart of lookUpVariable.
+func (s *stmtInterpreter) assignVariable(name scanner.Token, expr parser.Expr, value Value) error {
+	distance, ok := s.locals[expr]
+	if ok {
+		return s.Environment.assignAt(distance, name, value)
+	}
+	return s.globals.assign(name, value)
+}
+
+func (s *stmtInterpreter) VisitLiteralExpr(expr *parser.LiteralExpr) (interface{}, error) {
+	return expr.Value, nil
+}
+
+func (s *stmtInterpreter) VisitThisExpr(expr *parser.ThisExpr) (interface{}, error) {
+	return s.lookUpVariable(expr.Keyword, expr)
+}
+
+func (s *stmtInterpreter) VisitGroupingExpr(expr *parser.GroupingExpr) (interface{}, error) {
+	return s.evaluate(expr.Expression)
 }
 
-func areStrings(left, right result) bool {
-	return left.valueType == scanner.STRING && right.valueType == scanner.STRING
+// stringify is the one place that decides how a Value is shown to the user.
+func stringify(value Value) string {
+	return stringifyNested(value, map[Value]bool{})
 }
 
-func isEqual(left, right result) bool {
-	return left.valueType == right.valueType && left.Value == right.Value
+// stringifyNested is stringify for a value found inside the collections in
+// printing. A list or map that is already being printed shows up again as
+// "[...]" or "{...}", so one that contains itself doesn't recurse forever.
+func stringifyNested(value Value, printing map[Value]bool) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case *loxFunction:
+		if v.name == "" {
+			return "<fn>"
+		}
+		return "<fn " + v.name + ">"
+	case *nativeFunction:
+		return "<native fn>"
+	case *loxClass:
+		return v.name
+	case *loxInstance:
+		return v.class.name + " instance"
+	case *loxList:
+		if printing[v] {
+			return "[...]"
+		}
+		printing[v] = true
+		defer delete(printing, v)
+
+		elements := make([]string, len(v.elements))
+		for i, element := range v.elements {
+			elements[i] = stringifyNested(element, printing)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *loxMap:
+		if printing[v] {
+			return "{...}"
+		}
+		printing[v] = true
+		defer delete(printing, v)
+
+		entries := make([]string, len(v.keys))
+		for i, key := range v.keys {
+			entries[i] = stringify(key) + ": " + stringifyNested(v.values[key], printing)
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+	return fmt.Sprintf("%v", value)
 }
 
-func checkAreNumbers(left, right result, line int) bool {
-	if !areNumbers(left, right) {
-		errorHand.Error(line, "Operands must be numbers.")
+func isTruthy(value Value) bool {
+	switch v := value.(type) {
+	case nil:
 		return false
+	case bool:
+		return v
 	}
 	return true
 }
 
-func booleanResult(value bool) result {
-	if value {
-		return result{"true", scanner.TRUE}
+func isEqual(left, right Value) bool {
+	return left == right
+}
+
+// flooredMod is the remainder of the floored division of a by b, so the
+// result takes the sign of b: -7 % 3 is 2 and 7 % -3 is -2.
+func flooredMod(a, b float64) float64 {
+	r := math.Mod(a, b)
+	if r != 0 && (r < 0) != (b < 0) {
+		r += b
+	}
+	return r
+}
+
+func numberOperands(left, right Value) (float64, float64, bool) {
+	nLeft, ok := left.(float64)
+	if !ok {
+		return 0, 0, false
+	}
+	nRight, ok := right.(float64)
+	if !ok {
+		return 0, 0, false
 	}
-	return result{"false", scanner.FALSE}
+	return nLeft, nRight, true
 }
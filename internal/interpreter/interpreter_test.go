@@ -0,0 +1,225 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/errorHand"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// testNative is a native function a test registers for its program.
+type testNative struct {
+	name     string
+	arity    int
+	function NativeFunc
+}
+
+// run parses and executes source as a whole program and returns the error
+// it stopped with, if any. The program can call natives and check(got,
+// want), which fails with a runtime error when the two are not equal.
+func run(t *testing.T, source string, natives ...testNative) error {
+	t.Helper()
+	errorHand.HadError = false
+	defer func() {
+		errorHand.HadError = false
+	}()
+
+	tokens := scanner.NewScanner([]byte(source)).Scan([]byte(source))
+	p := parser.NewParser(tokens)
+	stmts := p.ParseStmts()
+	if errorHand.HadError {
+		t.Fatalf("%q: unexpected syntax error", source)
+	}
+	s := NewStmtInterpreter(stmts)
+	s.RegisterNative("check", 2, func(ctx *CallContext, args []Value) (Value, error) {
+		if !isEqual(args[0], args[1]) {
+			return nil, fmt.Errorf("got %s, want %s", stringify(args[0]), stringify(args[1]))
+		}
+		return nil, nil
+	})
+	for _, native := range natives {
+		s.RegisterNative(native.name, native.arity, native.function)
+	}
+	s.Resolve()
+	if errorHand.HadError {
+		t.Fatalf("%q: unexpected resolution error", source)
+	}
+	return s.ExecuteStmts()
+}
+
+func TestStackOverflow(t *testing.T) {
+	err := run(t, "fun f() {\n  f();\n}\nf();")
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("want a *RuntimeError, got %v", err)
+	}
+	if runtimeErr.Message != "Stack overflow." {
+		t.Errorf("got message %q, want %q", runtimeErr.Message, "Stack overflow.")
+	}
+	if len(runtimeErr.Stack) != maxCallDepth {
+		t.Errorf("got %d frames, want %d", len(runtimeErr.Stack), maxCallDepth)
+	}
+	if runtimeErr.Token.Line != 2 {
+		t.Errorf("raised on line %d, want 2", runtimeErr.Token.Line)
+	}
+}
+
+func TestStringifySelfContainingList(t *testing.T) {
+	inner := &loxList{elements: []Value{1.0}}
+	list := &loxList{elements: []Value{inner, inner}}
+	list.elements = append(list.elements, list)
+	inner.elements = append(inner.elements, list)
+
+	want := "[[1, [...]], [1, [...]], [...]]"
+	if got := stringify(list); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestStringifySelfContainingMap(t *testing.T) {
+	m := newLoxMap()
+	list := &loxList{elements: []Value{m}}
+	if err := m.set("k", m); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.set("l", list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "{k: {...}, l: [{...}]}"
+	if got := stringify(m); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestConstants(t *testing.T) {
+	// g's x is the global one, not the x f declares after g
+	err := run(t, "var x = 1; fun f() { fun g() { x = 2; } const x = 0; g(); } f();")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the resolver can't tell, as f could run before x is declared
+	source := "fun f() { x = 2; } const x = 1; f();"
+	err = run(t, source)
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("%q: want a *RuntimeError, got %v", source, err)
+	}
+	if want := "Can't reassign constant 'x'."; runtimeErr.Message != want {
+		t.Errorf("%q: got message %q, want %q", source, runtimeErr.Message, want)
+	}
+}
+
+func TestClosuresCaptureDeclaringScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"read", `var a = "global"; { fun get() { return a; } check(get(), "global"); var a = "block"; check(get(), "global"); }`},
+		{"assign", `var a = "global"; { fun set() { a = "set"; } var a = "block"; set(); check(a, "block"); }`},
+		{"lambda", `var a = "global"; { var get = fun () { return a; }; var a = "block"; check(get(), "global"); }`},
+		{"compound assign", `var n = 1; { fun inc() { n += 1; } var n = 10; inc(); check(n, 10); }`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := run(t, tt.source)
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", tt.source, err)
+			}
+		})
+	}
+}
+
+// mapList is a Go native calling its Lox callback on every element of a
+// list, the way natives taking callbacks work.
+func mapList(ctx *CallContext, args []Value) (Value, error) {
+	elements, ok := ListElements(args[0])
+	if !ok {
+		return nil, errors.New("First argument to mapList() must be a list.")
+	}
+	for i, element := range elements {
+		mapped, err := ctx.Call(args[1], element)
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = mapped
+	}
+	return NewList(elements)
+}
+
+func TestRegisterNative(t *testing.T) {
+	natives := []testNative{
+		{"mapList", 2, mapList},
+		{"pair", 0, func(ctx *CallContext, args []Value) (Value, error) {
+			return NewMap([]Value{"a", 1.0}, []Value{true, "one"})
+		}},
+		{"goInt", 0, func(ctx *CallContext, args []Value) (Value, error) {
+			return 1, nil
+		}},
+	}
+
+	err := run(t, `
+var doubled = mapList([1, 2, 3], fun (n) { return n * 2; });
+check(len(doubled), 3);
+check(doubled[2], 6);
+class Box { init(v) { this.v = v; } }
+check(mapList([7], Box)[0].v, 7);
+var m = pair();
+check(m["a"], true);
+check(m[1], "one");`, natives...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// errors in the callback keep the stack through the native
+	err = run(t, "fun bad(n) {\n  return n + nil;\n}\nmapList([1], bad);", natives...)
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("want a *RuntimeError, got %v", err)
+	}
+	var functions []string
+	for _, frame := range runtimeErr.Stack {
+		functions = append(functions, frame.Function)
+	}
+	if got := fmt.Sprint(functions); got != "[bad mapList]" {
+		t.Errorf("got stack %s, want [bad mapList]", got)
+	}
+
+	err = run(t, "mapList([1], 2);", natives...)
+	if err == nil || err.Error() != "Can only call functions and classes." {
+		t.Errorf("calling a number: got %v", err)
+	}
+
+	err = run(t, "goInt();", natives...)
+	if err == nil || err.Error() != "goInt() returned a Go int, which is not a Lox value." {
+		t.Errorf("returning an int: got %v", err)
+	}
+}
+
+func TestExprInterpreterNative(t *testing.T) {
+	source := "twice(fun (n) { return n + 1; }, 1)"
+	tokens := scanner.NewScanner([]byte(source)).Scan([]byte(source))
+	p := parser.NewParser(tokens)
+	inter := NewExprInterpreter(p.ParseExpr())
+	inter.RegisterNative("twice", 2, func(ctx *CallContext, args []Value) (Value, error) {
+		once, err := ctx.Call(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		return ctx.Call(args[0], once)
+	})
+	inter.Resolve()
+
+	got, err := inter.Interpret()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "3" {
+		t.Errorf("got %s, want 3", got)
+	}
+}
@@ -0,0 +1,210 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// NativeFunc is the Go implementation of a function callable from Lox.
+// Returning an error raises a runtime error at the call site with the
+// error text as message. The value it returns must be a Value: nil, a bool,
+// a float64, a string, or something it got from Lox, NewList or NewMap.
+type NativeFunc func(ctx *CallContext, args []Value) (Value, error)
+
+// CallContext is what a native function gets from the interpreter running
+// it, so it can call back into Lox.
+type CallContext struct {
+	interpreter *stmtInterpreter
+	paren       scanner.Token
+}
+
+// Call calls a Lox function, class or native with args. The errors it
+// returns are runtime errors that already hold the Lox call stack, and the
+// native should return them as they are.
+func (ctx *CallContext) Call(callee Value, args ...Value) (Value, error) {
+	function, ok := callee.(callable)
+	if !ok {
+		return nil, newRuntimeError(ctx.paren, "Can only call functions and classes.")
+	}
+	return ctx.interpreter.call(function, args, ctx.paren)
+}
+
+type nativeFunction struct {
+	name     string
+	argCount int
+	function NativeFunc
+}
+
+func (n *nativeFunction) arity() int {
+	return n.argCount
+}
+
+func (n *nativeFunction) call(s *stmtInterpreter, paren scanner.Token, args []Value) (Value, error) {
+	value, err := n.function(&CallContext{interpreter: s, paren: paren}, args)
+	if err != nil {
+		return nil, err
+	}
+	if !isValue(value) {
+		return nil, fmt.Errorf("%s() returned a Go %T, which is not a Lox value.", n.name, value)
+	}
+	return value, nil
+}
+
+// RegisterNative defines a native function in the global environment. It has
+// to be called before ExecuteStmts so scripts can see it.
+func (s *stmtInterpreter) RegisterNative(name string, arity int, function NativeFunc) {
+	s.globals.define(name, &nativeFunction{
+		name:     name,
+		argCount: arity,
+		function: function,
+	})
+}
+
+func (s *stmtInterpreter) defineNatives() {
+	s.RegisterNative("clock", 0, clock)
+	s.RegisterNative("len", 1, length)
+	s.RegisterNative("push", 2, push)
+	s.RegisterNative("pop", 1, pop)
+	s.RegisterNative("insert", 3, insert)
+	s.RegisterNative("remove", 2, remove)
+	s.RegisterNative("keys", 1, keys)
+	s.RegisterNative("values", 1, values)
+	s.RegisterNative("has", 2, has)
+	s.RegisterNative("delete", 2, deleteKey)
+}
+
+// clock returns the seconds elapsed since the Unix epoch.
+func clock(ctx *CallContext, args []Value) (Value, error) {
+	return float64(time.Now().UnixMilli()) / 1000.0, nil
+}
+
+// length returns the number of elements of a list, entries of a map or
+// bytes of a string.
+func length(ctx *CallContext, args []Value) (Value, error) {
+	switch v := args[0].(type) {
+	case *loxList:
+		return float64(len(v.elements)), nil
+	case *loxMap:
+		return float64(len(v.keys)), nil
+	case string:
+		return float64(len(v)), nil
+	}
+	return nil, errors.New("Argument to len() must be a list, a map or a string.")
+}
+
+// push appends a value to the end of a list.
+func push(ctx *CallContext, args []Value) (Value, error) {
+	list, err := listArg("push", args)
+	if err != nil {
+		return nil, err
+	}
+	list.elements = append(list.elements, args[1])
+	return nil, nil
+}
+
+// pop removes the last element of a list and returns it.
+func pop(ctx *CallContext, args []Value) (Value, error) {
+	list, err := listArg("pop", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(list.elements) == 0 {
+		return nil, errors.New("Can't pop from an empty list.")
+	}
+	last := list.elements[len(list.elements)-1]
+	list.elements = list.elements[:len(list.elements)-1]
+	return last, nil
+}
+
+// insert puts a value at an index of a list, shifting the elements after it.
+// The index can be the length of the list to append.
+func insert(ctx *CallContext, args []Value) (Value, error) {
+	list, err := listArg("insert", args)
+	if err != nil {
+		return nil, err
+	}
+	i, err := listIndex(args[1], len(list.elements)+1)
+	if err != nil {
+		return nil, err
+	}
+	list.elements = append(list.elements, nil)
+	copy(list.elements[i+1:], list.elements[i:])
+	list.elements[i] = args[2]
+	return nil, nil
+}
+
+// remove deletes the element at an index of a list and returns it.
+func remove(ctx *CallContext, args []Value) (Value, error) {
+	list, err := listArg("remove", args)
+	if err != nil {
+		return nil, err
+	}
+	i, err := listIndex(args[1], len(list.elements))
+	if err != nil {
+		return nil, err
+	}
+	removed := list.elements[i]
+	list.elements = append(list.elements[:i], list.elements[i+1:]...)
+	return removed, nil
+}
+
+func listArg(name string, args []Value) (*loxList, error) {
+	list, ok := args[0].(*loxList)
+	if !ok {
+		return nil, errors.New("First argument to " + name + "() must be a list.")
+	}
+	return list, nil
+}
+
+// keys returns a new list with the keys of a map, in insertion order.
+func keys(ctx *CallContext, args []Value) (Value, error) {
+	m, err := mapArg("keys", args)
+	if err != nil {
+		return nil, err
+	}
+	return &loxList{elements: append([]Value(nil), m.keys...)}, nil
+}
+
+// values returns a new list with the values of a map, in the order of its
+// keys.
+func values(ctx *CallContext, args []Value) (Value, error) {
+	m, err := mapArg("values", args)
+	if err != nil {
+		return nil, err
+	}
+	elements := make([]Value, len(m.keys))
+	for i, key := range m.keys {
+		elements[i] = m.values[key]
+	}
+	return &loxList{elements: elements}, nil
+}
+
+// has tells whether a map has a key.
+func has(ctx *CallContext, args []Value) (Value, error) {
+	m, err := mapArg("has", args)
+	if err != nil {
+		return nil, err
+	}
+	_, ok := m.values[args[1]]
+	return ok, nil
+}
+
+// deleteKey removes a key from a map, returning whether it was there.
+func deleteKey(ctx *CallContext, args []Value) (Value, error) {
+	m, err := mapArg("delete", args)
+	if err != nil {
+		return nil, err
+	}
+	return m.delete(args[1]), nil
+}
+
+func mapArg(name string, args []Value) (*loxMap, error) {
+	m, ok := args[0].(*loxMap)
+	if !ok {
+		return nil, errors.New("First argument to " + name + "() must be a map.")
+	}
+	return m, nil
+}
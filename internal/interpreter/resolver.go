@@ -0,0 +1,384 @@
+package interpreter
+
+import (
+	"github.com/codecrafters-io/interpreter-starter-go/internal/errorHand"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// resolver is the ExprVisitor and StmtVisitor that runs between parsing and
+// interpreting. It binds every use of a local variable to the scope that
+// declares it, recording in locals how many environments up from the use
+// that scope is. Names it can't find in any scope are globals.
+//
+// Its scopes have to open and close exactly where the interpreter creates
+// and leaves environments, so the recorded distances line up at runtime.
+//
+// It also reports assignments to constants. Globals are only bound at
+// runtime, but a global constant can't be declared again, so assigning to
+// one declared earlier in the program is an error here too.
+type resolver struct {
+	locals map[parser.Expr]int
+	// scopes maps the names declared in each enclosing local scope,
+	// innermost last, to what is known about them.
+	scopes []map[string]*variable
+	// globalConsts holds the global constants declared so far.
+	globalConsts map[string]bool
+}
+
+type variable struct {
+	// defined is false while the initializer is being resolved
+	defined bool
+	isConst bool
+}
+
+// Resolve binds the variables of the program to their declarations,
+// reporting errors like the parser does. It has to run before ExecuteStmts.
+func (s *stmtInterpreter) Resolve() {
+	r := resolver{locals: s.locals, globalConsts: make(map[string]bool)}
+	r.resolveStmts(s.stmts)
+}
+
+// Resolve binds the variables of the expression to their declarations,
+// reporting errors like the parser does. It has to run before Interpret.
+func (inter *exprInterpreter) Resolve() {
+	r := resolver{locals: inter.interpreter.locals, globalConsts: make(map[string]bool)}
+	r.resolveExpr(inter.expr)
+}
+
+func (r *resolver) resolveStmts(stmts []parser.Statement) {
+	for _, stmt := range stmts {
+		r.resolveStmt(stmt)
+	}
+}
+
+func (r *resolver) resolveStmt(stmt parser.Statement) {
+	if stmt != nil {
+		stmt.Accept(r)
+	}
+}
+
+func (r *resolver) resolveExprs(exprs []parser.Expr) {
+	for _, expr := range exprs {
+		r.resolveExpr(expr)
+	}
+}
+
+func (r *resolver) resolveExpr(expr parser.Expr) {
+	if expr != nil {
+		expr.Accept(r)
+	}
+}
+
+func (r *resolver) beginScope() {
+	r.scopes = append(r.scopes, map[string]*variable{})
+}
+
+func (r *resolver) endScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+// declare adds name to the innermost scope, not yet usable until define.
+// Globals can be declared again, unless they are constants.
+func (r *resolver) declare(name scanner.Token, isConst bool) {
+	if len(r.scopes) == 0 {
+		if r.globalConsts[name.Lexeme] {
+			errorHand.ParseError(name.Lexeme, name.Line, "Can't redeclare constant '"+name.Lexeme+"'.")
+		}
+		if isConst {
+			r.globalConsts[name.Lexeme] = true
+		}
+		return
+	}
+
+	scope := r.scopes[len(r.scopes)-1]
+	if existing, ok := scope[name.Lexeme]; ok {
+		if existing.isConst {
+			errorHand.ParseError(name.Lexeme, name.Line, "Can't redeclare constant '"+name.Lexeme+"'.")
+		} else {
+			errorHand.ParseError(name.Lexeme, name.Line, "Already a variable with this name in this scope.")
+		}
+	}
+	scope[name.Lexeme] = &variable{defined: false, isConst: isConst}
+}
+
+func (r *resolver) define(name scanner.Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	r.scopes[len(r.scopes)-1][name.Lexeme].defined = true
+}
+
+// resolveLocal records the distance to the innermost scope declaring name,
+// leaving expr out of locals when name is a global.
+func (r *resolver) resolveLocal(expr parser.Expr, name scanner.Token) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if _, ok := r.scopes[i][name.Lexeme]; ok {
+			r.locals[expr] = len(r.scopes) - 1 - i
+			return
+		}
+	}
+}
+
+// checkNotConstant reports assigning to name when it is bound to a
+// constant.
+func (r *resolver) checkNotConstant(name scanner.Token) {
+	isConst := r.globalConsts[name.Lexeme]
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if v, ok := r.scopes[i][name.Lexeme]; ok {
+			isConst = v.isConst
+			break
+		}
+	}
+	if isConst {
+		errorHand.ParseError(name.Lexeme, name.Line, "Can't reassign constant '"+name.Lexeme+"'.")
+	}
+}
+
+// checkTarget runs checkNotConstant for the targets of compound assignments
+// and increments that are variables.
+func (r *resolver) checkTarget(target parser.Expr) {
+	if variable, ok := target.(*parser.VariableExpr); ok {
+		r.checkNotConstant(variable.Name)
+	}
+}
+
+// resolveFunction resolves a function body in a single scope holding the
+// params, the same environment loxFunction.call runs the body in.
+func (r *resolver) resolveFunction(params []scanner.Token, body []parser.Statement) {
+	r.beginScope()
+	for _, param := range params {
+		r.declare(param, false)
+		r.define(param)
+	}
+	r.resolveStmts(body)
+	r.endScope()
+}
+
+func (r *resolver) VisitBlockStmt(stmt *parser.BlockStmt) (interface{}, error) {
+	r.beginScope()
+	r.resolveStmts(stmt.Statements)
+	r.endScope()
+	return nil, nil
+}
+
+func (r *resolver) VisitBreakStmt(stmt *parser.BreakStmt) (interface{}, error) {
+	return nil, nil
+}
+
+// VisitClassStmt mirrors the environments methods close over: one holding
+// "super" for subclasses, and the one bind adds for "this".
+func (r *resolver) VisitClassStmt(stmt *parser.ClassStmt) (interface{}, error) {
+	r.declare(stmt.Name, false)
+	r.define(stmt.Name)
+
+	if stmt.Superclass != nil {
+		r.resolveExpr(stmt.Superclass)
+		r.beginScope()
+		r.scopes[len(r.scopes)-1]["super"] = &variable{defined: true, isConst: false}
+	}
+
+	r.beginScope()
+	r.scopes[len(r.scopes)-1]["this"] = &variable{defined: true, isConst: false}
+	for _, method := range stmt.Methods {
+		r.resolveFunction(method.Params, method.Body)
+	}
+	r.endScope()
+
+	if stmt.Superclass != nil {
+		r.endScope()
+	}
+	return nil, nil
+}
+
+func (r *resolver) VisitContinueStmt(stmt *parser.ContinueStmt) (interface{}, error) {
+	return nil, nil
+}
+
+func (r *resolver) VisitExprStmt(stmt *parser.ExprStmt) (interface{}, error) {
+	r.resolveExpr(stmt.Expr)
+	return nil, nil
+}
+
+// VisitFunctionStmt defines the name before resolving the body, so the
+// function can call itself.
+func (r *resolver) VisitFunctionStmt(stmt *parser.FunctionStmt) (interface{}, error) {
+	r.declare(stmt.Name, false)
+	r.define(stmt.Name)
+	r.resolveFunction(stmt.Params, stmt.Body)
+	return nil, nil
+}
+
+func (r *resolver) VisitIfStmt(stmt *parser.IfStmt) (interface{}, error) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.ThenBranch)
+	r.resolveStmt(stmt.ElseBranch)
+	return nil, nil
+}
+
+func (r *resolver) VisitPrintStmt(stmt *parser.PrintStmt) (interface{}, error) {
+	r.resolveExpr(stmt.Expr)
+	return nil, nil
+}
+
+func (r *resolver) VisitReturnStmt(stmt *parser.ReturnStmt) (interface{}, error) {
+	r.resolveExpr(stmt.Value)
+	return nil, nil
+}
+
+// VisitSwitchStmt resolves every case body in its own scope, as each one
+// runs in a new environment.
+func (r *resolver) VisitSwitchStmt(stmt *parser.SwitchStmt) (interface{}, error) {
+	r.resolveExpr(stmt.Subject)
+	for _, clause := range stmt.Cases {
+		r.resolveSwitchCase(clause)
+	}
+	if stmt.Default != nil {
+		r.resolveSwitchCase(stmt.Default)
+	}
+	return nil, nil
+}
+
+func (r *resolver) resolveSwitchCase(clause *parser.SwitchCase) {
+	r.resolveExprs(clause.Values)
+	r.beginScope()
+	r.resolveStmts(clause.Body)
+	r.endScope()
+}
+
+// VisitVarDeclStmt declares the name before resolving the initializer, so
+// the initializer can't read the variable it is initializing.
+func (r *resolver) VisitVarDeclStmt(stmt *parser.VarDeclStmt) (interface{}, error) {
+	r.declare(stmt.Name, stmt.Const)
+	r.resolveExpr(stmt.Initializer)
+	r.define(stmt.Name)
+	return nil, nil
+}
+
+func (r *resolver) VisitWhileStmt(stmt *parser.WhileStmt) (interface{}, error) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.Body)
+	r.resolveExpr(stmt.Increment)
+	return nil, nil
+}
+
+func (r *resolver) VisitAssignExpr(expr *parser.AssignExpr) (interface{}, error) {
+	r.resolveExpr(expr.Value)
+	r.resolveLocal(expr, expr.Name)
+	r.checkNotConstant(expr.Name)
+	return nil, nil
+}
+
+func (r *resolver) VisitBinaryExpr(expr *parser.BinaryExpr) (interface{}, error) {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *resolver) VisitCallExpr(expr *parser.CallExpr) (interface{}, error) {
+	r.resolveExpr(expr.Callee)
+	r.resolveExprs(expr.Arguments)
+	return nil, nil
+}
+
+func (r *resolver) VisitCompoundAssignExpr(expr *parser.CompoundAssignExpr) (interface{}, error) {
+	r.resolveExpr(expr.Target)
+	r.checkTarget(expr.Target)
+	r.resolveExpr(expr.Value)
+	return nil, nil
+}
+
+func (r *resolver) VisitConditionalExpr(expr *parser.ConditionalExpr) (interface{}, error) {
+	r.resolveExpr(expr.Condition)
+	r.resolveExpr(expr.ThenBranch)
+	r.resolveExpr(expr.ElseBranch)
+	return nil, nil
+}
+
+func (r *resolver) VisitFunctionExpr(expr *parser.FunctionExpr) (interface{}, error) {
+	r.resolveFunction(expr.Params, expr.Body)
+	return nil, nil
+}
+
+func (r *resolver) VisitGetExpr(expr *parser.GetExpr) (interface{}, error) {
+	r.resolveExpr(expr.Object)
+	return nil, nil
+}
+
+func (r *resolver) VisitGroupingExpr(expr *parser.GroupingExpr) (interface{}, error) {
+	r.resolveExpr(expr.Expression)
+	return nil, nil
+}
+
+func (r *resolver) VisitIncrementExpr(expr *parser.IncrementExpr) (interface{}, error) {
+	r.resolveExpr(expr.Target)
+	r.checkTarget(expr.Target)
+	return nil, nil
+}
+
+func (r *resolver) VisitIndexExpr(expr *parser.IndexExpr) (interface{}, error) {
+	r.resolveExpr(expr.Object)
+	r.resolveExpr(expr.Index)
+	return nil, nil
+}
+
+func (r *resolver) VisitIndexSetExpr(expr *parser.IndexSetExpr) (interface{}, error) {
+	r.resolveExpr(expr.Object)
+	r.resolveExpr(expr.Index)
+	r.resolveExpr(expr.Value)
+	return nil, nil
+}
+
+func (r *resolver) VisitListExpr(expr *parser.ListExpr) (interface{}, error) {
+	r.resolveExprs(expr.Elements)
+	return nil, nil
+}
+
+func (r *resolver) VisitMapExpr(expr *parser.MapExpr) (interface{}, error) {
+	for i, key := range expr.Keys {
+		r.resolveExpr(key)
+		r.resolveExpr(expr.Values[i])
+	}
+	return nil, nil
+}
+
+func (r *resolver) VisitLiteralExpr(expr *parser.LiteralExpr) (interface{}, error) {
+	return nil, nil
+}
+
+func (r *resolver) VisitLogicalExpr(expr *parser.LogicalExpr) (interface{}, error) {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *resolver) VisitSetExpr(expr *parser.SetExpr) (interface{}, error) {
+	r.resolveExpr(expr.Value)
+	r.resolveExpr(expr.Object)
+	return nil, nil
+}
+
+func (r *resolver) VisitSuperExpr(expr *parser.SuperExpr) (interface{}, error) {
+	r.resolveLocal(expr, expr.Keyword)
+	return nil, nil
+}
+
+func (r *resolver) VisitThisExpr(expr *parser.ThisExpr) (interface{}, error) {
+	r.resolveLocal(expr, expr.Keyword)
+	return nil, nil
+}
+
+func (r *resolver) VisitUnaryExpr(expr *parser.UnaryExpr) (interface{}, error) {
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *resolver) VisitVariableExpr(expr *parser.VariableExpr) (interface{}, error) {
+	if len(r.scopes) > 0 {
+		if v, ok := r.scopes[len(r.scopes)-1][expr.Name.Lexeme]; ok && !v.defined {
+			errorHand.ParseError(expr.Name.Lexeme, expr.Name.Line, "Can't read local variable in its own initializer.")
+		}
+	}
+	r.resolveLocal(expr, expr.Name)
+	return nil, nil
+}
@@ -0,0 +1,97 @@
+package interpreter
+
+import (
+	"testing"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/errorHand"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/parser"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// resolve parses and resolves source as a whole program and reports whether
+// either step found an error.
+func resolve(t *testing.T, source string) bool {
+	t.Helper()
+	errorHand.HadError = false
+	defer func() {
+		errorHand.HadError = false
+	}()
+
+	tokens := scanner.NewScanner([]byte(source)).Scan([]byte(source))
+	p := parser.NewParser(tokens)
+	s := NewStmtInterpreter(p.ParseStmts())
+	if errorHand.HadError {
+		return true
+	}
+	s.Resolve()
+	return errorHand.HadError
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		wantErr bool
+	}{
+		{"own initializer", "{ var a = 1; { var a = a; } }", true},
+		{"redeclare local", "{ var a = 1; var a = 2; }", true},
+		{"redeclare parameter", "fun f(a) { var a = 1; }", true},
+		{"redeclare global", "var a = 1; var a = 2;", false},
+		{"outer in initializer", "{ var a = 1; { var b = a; } }", false},
+		{"recursive local function", "{ fun f(n) { if (n > 0) f(n - 1); } f(1); }", false},
+		{"lambda reading its variable", "{ var f = fun () { return f; }; }", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolve(t, tt.source); got != tt.wantErr {
+				t.Errorf("%q: got error %v, want %v", tt.source, got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConstantErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		wantErr bool
+	}{
+		{"assign", "const x = 1; x = 2;", true},
+		{"compound assign", "const x = 1; x += 2;", true},
+		{"postfix increment", "const x = 1; x++;", true},
+		{"prefix decrement", "const x = 1; --x;", true},
+		{"assign in block", "const x = 1; { x = 2; }", true},
+		{"assign in loop", "const x = 1; while (true) { x = 2; }", true},
+		{"assign in function", "const x = 1; fun f() { x = 2; }", true},
+		{"local assign", "{ const x = 1; x = 2; }", true},
+		{"redeclare const", "const x = 1; const x = 2;", true},
+		{"redeclare as var", "const x = 1; var x = 2;", true},
+		{"redeclare as function", "const x = 1; fun x() {}", true},
+		{"redeclare local", "{ const x = 1; var x = 2; }", true},
+		{"missing initializer", "const x;", true},
+
+		{"shadowed in block", "const x = 1; { var x = 0; x = 2; }", false},
+		{"shadowed by parameter", "const x = 1; fun f(x) { x = 2; }", false},
+		{"const in other block", "{ const x = 1; } var x = 0; x = 2;", false},
+		{"field named like const", "const x = 1; var o; o.x = 2;", false},
+		{"global declared after use", "fun f() { x = 2; } const x = 1;", false},
+
+		// g's x is whatever x is in scope where g is written, whatever f
+		// declares later
+		{"outer const shadowed later",
+			"const x = 1; fun f() { fun g() { x = 2; } var x = 0; g(); print x; } f();", true},
+		{"outer var shadowed by const later",
+			"var x = 1; fun f() { fun g() { x = 2; } const x = 0; g(); } f();", false},
+		{"const in enclosing function", "fun f() { const x = 1; fun g() { x = 2; } }", true},
+		{"const inside lambda", "var f = fun () { const x = 1; x = 2; };", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolve(t, tt.source); got != tt.wantErr {
+				t.Errorf("%q: got error %v, want %v", tt.source, got, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,441 @@
+package parser
+
+import (
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// spanned is embedded in every node to record the source range it was
+// parsed from.
+type spanned struct {
+	span scanner.Span
+}
+
+func (s spanned) Span() scanner.Span {
+	return s.span
+}
+
+func (s *spanned) setSpan(span scanner.Span) {
+	s.span = span
+}
+
+// ************************* Expressions *************************
+
+type Expr interface {
+	Accept(visitor ExprVisitor) (interface{}, error)
+	Span() scanner.Span
+	setSpan(span scanner.Span)
+}
+
+type ExprVisitor interface {
+	VisitAssignExpr(expr *AssignExpr) (interface{}, error)
+	VisitBinaryExpr(expr *BinaryExpr) (interface{}, error)
+	VisitCallExpr(expr *CallExpr) (interface{}, error)
+	VisitCompoundAssignExpr(expr *CompoundAssignExpr) (interface{}, error)
+	VisitConditionalExpr(expr *ConditionalExpr) (interface{}, error)
+	VisitFunctionExpr(expr *FunctionExpr) (interface{}, error)
+	VisitGetExpr(expr *GetExpr) (interface{}, error)
+	VisitGroupingExpr(expr *GroupingExpr) (interface{}, error)
+	VisitIncrementExpr(expr *IncrementExpr) (interface{}, error)
+	VisitIndexExpr(expr *IndexExpr) (interface{}, error)
+	VisitIndexSetExpr(expr *IndexSetExpr) (interface{}, error)
+	VisitListExpr(expr *ListExpr) (interface{}, error)
+	VisitMapExpr(expr *MapExpr) (interface{}, error)
+	VisitLiteralExpr(expr *LiteralExpr) (interface{}, error)
+	VisitLogicalExpr(expr *LogicalExpr) (interface{}, error)
+	VisitSetExpr(expr *SetExpr) (interface{}, error)
+	VisitSuperExpr(expr *SuperExpr) (interface{}, error)
+	VisitThisExpr(expr *ThisExpr) (interface{}, error)
+	VisitUnaryExpr(expr *UnaryExpr) (interface{}, error)
+	VisitVariableExpr(expr *VariableExpr) (interface{}, error)
+}
+
+type AssignExpr struct {
+	spanned
+	Name  scanner.Token
+	Value Expr
+}
+
+func (e *AssignExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitAssignExpr(e)
+}
+
+type BinaryExpr struct {
+	spanned
+	Left     Expr
+	Operator scanner.Token
+	Right    Expr
+}
+
+func (e *BinaryExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitBinaryExpr(e)
+}
+
+// CallExpr keeps the closing paren to report errors on the line of the call.
+type CallExpr struct {
+	spanned
+	Callee    Expr
+	Paren     scanner.Token
+	Arguments []Expr
+}
+
+func (e *CallExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitCallExpr(e)
+}
+
+// CompoundAssignExpr is "Target op= Value", where Target is a VariableExpr,
+// a GetExpr or an IndexExpr and Operator is one of += -= *= /=.
+type CompoundAssignExpr struct {
+	spanned
+	Target   Expr
+	Operator scanner.Token
+	Value    Expr
+}
+
+func (e *CompoundAssignExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitCompoundAssignExpr(e)
+}
+
+// ConditionalExpr is the ternary "Condition ? ThenBranch : ElseBranch".
+type ConditionalExpr struct {
+	spanned
+	Condition  Expr
+	Question   scanner.Token
+	ThenBranch Expr
+	ElseBranch Expr
+}
+
+func (e *ConditionalExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitConditionalExpr(e)
+}
+
+// FunctionExpr is an anonymous function. Keyword is the 'fun' token, or the
+// '=>' of the arrow form, whose expression body is parsed into a single
+// return statement.
+type FunctionExpr struct {
+	spanned
+	Keyword scanner.Token
+	Params  []scanner.Token
+	Body    []Statement
+}
+
+func (e *FunctionExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitFunctionExpr(e)
+}
+
+type GetExpr struct {
+	spanned
+	Object Expr
+	Name   scanner.Token
+}
+
+func (e *GetExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitGetExpr(e)
+}
+
+type GroupingExpr struct {
+	spanned
+	Expression Expr
+}
+
+func (e *GroupingExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitGroupingExpr(e)
+}
+
+// IncrementExpr is a prefix or postfix ++ or --. Target is a VariableExpr, a
+// GetExpr or an IndexExpr.
+type IncrementExpr struct {
+	spanned
+	Target   Expr
+	Operator scanner.Token
+	Prefix   bool
+}
+
+func (e *IncrementExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitIncrementExpr(e)
+}
+
+// IndexExpr is "Object[Index]". Bracket is the closing ']', used to report
+// errors on the line of the access.
+type IndexExpr struct {
+	spanned
+	Object  Expr
+	Bracket scanner.Token
+	Index   Expr
+}
+
+func (e *IndexExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitIndexExpr(e)
+}
+
+type IndexSetExpr struct {
+	spanned
+	Object  Expr
+	Bracket scanner.Token
+	Index   Expr
+	Value   Expr
+}
+
+func (e *IndexSetExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitIndexSetExpr(e)
+}
+
+type ListExpr struct {
+	spanned
+	Elements []Expr
+}
+
+func (e *ListExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitListExpr(e)
+}
+
+// MapExpr is a map literal; Keys[i] maps to Values[i]. Brace is the closing
+// '}', used to report errors on the line of the literal.
+type MapExpr struct {
+	spanned
+	Brace  scanner.Token
+	Keys   []Expr
+	Values []Expr
+}
+
+func (e *MapExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitMapExpr(e)
+}
+
+// LiteralExpr holds the literal already converted to nil, bool, float64 or
+// string, next to the token it was written as.
+type LiteralExpr struct {
+	spanned
+	Token scanner.Token
+	Value interface{}
+}
+
+func (e *LiteralExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitLiteralExpr(e)
+}
+
+type LogicalExpr struct {
+	spanned
+	Left     Expr
+	Operator scanner.Token
+	Right    Expr
+}
+
+func (e *LogicalExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitLogicalExpr(e)
+}
+
+type SetExpr struct {
+	spanned
+	Object Expr
+	Name   scanner.Token
+	Value  Expr
+}
+
+func (e *SetExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitSetExpr(e)
+}
+
+type SuperExpr struct {
+	spanned
+	Keyword scanner.Token
+	Method  scanner.Token
+}
+
+func (e *SuperExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitSuperExpr(e)
+}
+
+type ThisExpr struct {
+	spanned
+	Keyword scanner.Token
+}
+
+func (e *ThisExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitThisExpr(e)
+}
+
+type UnaryExpr struct {
+	spanned
+	Operator scanner.Token
+	Right    Expr
+}
+
+func (e *UnaryExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitUnaryExpr(e)
+}
+
+type VariableExpr struct {
+	spanned
+	Name scanner.Token
+}
+
+func (e *VariableExpr) Accept(visitor ExprVisitor) (interface{}, error) {
+	return visitor.VisitVariableExpr(e)
+}
+
+// ************************* Statements *************************
+
+type Statement interface {
+	Accept(visitor StmtVisitor) (interface{}, error)
+	Span() scanner.Span
+	setSpan(span scanner.Span)
+}
+
+type StmtVisitor interface {
+	VisitBlockStmt(stmt *BlockStmt) (interface{}, error)
+	VisitBreakStmt(stmt *BreakStmt) (interface{}, error)
+	VisitClassStmt(stmt *ClassStmt) (interface{}, error)
+	VisitContinueStmt(stmt *ContinueStmt) (interface{}, error)
+	VisitExprStmt(stmt *ExprStmt) (interface{}, error)
+	VisitFunctionStmt(stmt *FunctionStmt) (interface{}, error)
+	VisitIfStmt(stmt *IfStmt) (interface{}, error)
+	VisitPrintStmt(stmt *PrintStmt) (interface{}, error)
+	VisitReturnStmt(stmt *ReturnStmt) (interface{}, error)
+	VisitSwitchStmt(stmt *SwitchStmt) (interface{}, error)
+	VisitVarDeclStmt(stmt *VarDeclStmt) (interface{}, error)
+	VisitWhileStmt(stmt *WhileStmt) (interface{}, error)
+}
+
+type BlockStmt struct {
+	spanned
+	Statements []Statement
+}
+
+func (s *BlockStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitBlockStmt(s)
+}
+
+// BreakStmt has a nil Label when it targets the innermost loop.
+type BreakStmt struct {
+	spanned
+	Keyword scanner.Token
+	Label   *scanner.Token
+}
+
+func (s *BreakStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitBreakStmt(s)
+}
+
+// ClassStmt has a nil Superclass when the class does not inherit.
+type ClassStmt struct {
+	spanned
+	Name       scanner.Token
+	Superclass *VariableExpr
+	Methods    []*FunctionStmt
+}
+
+func (s *ClassStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitClassStmt(s)
+}
+
+// ContinueStmt has a nil Label when it targets the innermost loop.
+type ContinueStmt struct {
+	spanned
+	Keyword scanner.Token
+	Label   *scanner.Token
+}
+
+func (s *ContinueStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitContinueStmt(s)
+}
+
+type ExprStmt struct {
+	spanned
+	Expr Expr
+}
+
+func (s *ExprStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitExprStmt(s)
+}
+
+type FunctionStmt struct {
+	spanned
+	Name   scanner.Token
+	Params []scanner.Token
+	Body   []Statement
+}
+
+func (s *FunctionStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitFunctionStmt(s)
+}
+
+type IfStmt struct {
+	spanned
+	Condition  Expr
+	ThenBranch Statement
+	ElseBranch Statement
+}
+
+func (s *IfStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitIfStmt(s)
+}
+
+type PrintStmt struct {
+	spanned
+	Expr Expr
+}
+
+func (s *PrintStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitPrintStmt(s)
+}
+
+type ReturnStmt struct {
+	spanned
+	Keyword scanner.Token
+	Value   Expr
+}
+
+func (s *ReturnStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitReturnStmt(s)
+}
+
+// SwitchStmt runs the body of the first case with a value equal to Subject,
+// or the Default body if none matches. Default is nil when the switch has
+// none.
+type SwitchStmt struct {
+	spanned
+	Keyword scanner.Token
+	Subject Expr
+	Cases   []*SwitchCase
+	Default *SwitchCase
+}
+
+func (s *SwitchStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitSwitchStmt(s)
+}
+
+// SwitchCase is one "case a, b: body" clause, or the default clause, which
+// has no Values.
+type SwitchCase struct {
+	spanned
+	Values []Expr
+	Body   []Statement
+}
+
+// VarDeclStmt declares a variable, or a constant when Const is set, in
+// which case Initializer is never nil.
+type VarDeclStmt struct {
+	spanned
+	Name        scanner.Token
+	Initializer Expr
+	Const       bool
+}
+
+func (s *VarDeclStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitVarDeclStmt(s)
+}
+
+// WhileStmt is also what for loops desugar to. Increment is the for
+// increment clause, run after every iteration even when the body continues,
+// and is nil for plain while loops. Label is nil for unlabeled loops.
+type WhileStmt struct {
+	spanned
+	Label     *scanner.Token
+	Condition Expr
+	Body      Statement
+	Increment Expr
+}
+
+func (s *WhileStmt) Accept(visitor StmtVisitor) (interface{}, error) {
+	return visitor.VisitWhileStmt(s)
+}
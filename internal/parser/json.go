@@ -0,0 +1,425 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// jsonNode is the JSON form of an AST node: its Go type name under "kind",
+// its span under "span" and one entry per child or attribute. The fields of
+// every kind are listed in docs/json-format.md.
+type jsonNode map[string]interface{}
+
+// writeTo writes the node as compact JSON, "kind" and "span" first and the
+// other fields sorted by name, so the output is stable and easy to read.
+func (n jsonNode) writeTo(buf *bytes.Buffer) error {
+	var keys []string
+	for key := range n {
+		if key != "kind" && key != "span" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if _, ok := n["kind"]; ok {
+		keys = append([]string{"kind", "span"}, keys...)
+	}
+
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		err := writeJSON(buf, key)
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		err = writeJSON(buf, n[key])
+		if err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// writeJSON appends v to buf as compact JSON. Nodes and lists of them are
+// written here directly rather than through encoding/json, which would
+// compact and re-indent every subtree once per ancestor.
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case jsonNode:
+		return v.writeTo(buf)
+	case []jsonNode:
+		buf.WriteByte('[')
+		for i, n := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := n.writeTo(buf)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, element := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := writeJSON(buf, element)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(v)
+	if err != nil {
+		return err
+	}
+	// Encode ends every value with a newline
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// jsonEncoder is the ExprVisitor and StmtVisitor behind PrintASTJSON.
+type jsonEncoder struct{}
+
+// PrintASTJSON is the --format=json version of AstPrintStmts. The whole
+// tree is written compact first and indented once at the end.
+func PrintASTJSON(w io.Writer, stmts []Statement) error {
+	var compact bytes.Buffer
+	fmt.Fprintf(&compact, `{"version":%d,"statements":`, scanner.JSONVersion)
+	err := writeJSON(&compact, encodeStmts(stmts))
+	if err != nil {
+		return err
+	}
+	compact.WriteByte('}')
+
+	var out bytes.Buffer
+	err = json.Indent(&out, compact.Bytes(), "", "  ")
+	if err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err = out.WriteTo(w)
+	return err
+}
+
+func node(kind string, span scanner.Span, fields jsonNode) jsonNode {
+	fields["kind"] = kind
+	fields["span"] = span.ToJSON()
+	return fields
+}
+
+// encodeExpr returns nil for a missing expression, which encodes as null.
+func encodeExpr(expr Expr) interface{} {
+	if expr == nil {
+		return nil
+	}
+	encoded, _ := expr.Accept(jsonEncoder{})
+	return encoded
+}
+
+func encodeExprs(exprs []Expr) []interface{} {
+	encoded := make([]interface{}, len(exprs))
+	for i, expr := range exprs {
+		encoded[i] = encodeExpr(expr)
+	}
+	return encoded
+}
+
+// encodeStmt returns nil for a missing statement, which encodes as null.
+func encodeStmt(stmt Statement) interface{} {
+	if stmt == nil {
+		return nil
+	}
+	encoded, _ := stmt.Accept(jsonEncoder{})
+	return encoded
+}
+
+func encodeStmts(stmts []Statement) []jsonNode {
+	encoded := make([]jsonNode, len(stmts))
+	for i, stmt := range stmts {
+		encoded[i] = encodeStmt(stmt).(jsonNode)
+	}
+	return encoded
+}
+
+func encodeNames(tokens []scanner.Token) []string {
+	names := make([]string, len(tokens))
+	for i, token := range tokens {
+		names[i] = token.Lexeme
+	}
+	return names
+}
+
+// encodeLabel returns nil for a missing label, which encodes as null.
+func encodeLabel(label *scanner.Token) interface{} {
+	if label == nil {
+		return nil
+	}
+	return label.Lexeme
+}
+
+func (j jsonEncoder) VisitAssignExpr(expr *AssignExpr) (interface{}, error) {
+	return node("AssignExpr", expr.Span(), jsonNode{
+		"name":  expr.Name.Lexeme,
+		"value": encodeExpr(expr.Value),
+	}), nil
+}
+
+func (j jsonEncoder) VisitBinaryExpr(expr *BinaryExpr) (interface{}, error) {
+	return node("BinaryExpr", expr.Span(), jsonNode{
+		"operator": expr.Operator.Lexeme,
+		"left":     encodeExpr(expr.Left),
+		"right":    encodeExpr(expr.Right),
+	}), nil
+}
+
+func (j jsonEncoder) VisitCallExpr(expr *CallExpr) (interface{}, error) {
+	return node("CallExpr", expr.Span(), jsonNode{
+		"callee":    encodeExpr(expr.Callee),
+		"arguments": encodeExprs(expr.Arguments),
+	}), nil
+}
+
+func (j jsonEncoder) VisitCompoundAssignExpr(expr *CompoundAssignExpr) (interface{}, error) {
+	return node("CompoundAssignExpr", expr.Span(), jsonNode{
+		"operator": expr.Operator.Lexeme,
+		"target":   encodeExpr(expr.Target),
+		"value":    encodeExpr(expr.Value),
+	}), nil
+}
+
+func (j jsonEncoder) VisitConditionalExpr(expr *ConditionalExpr) (interface{}, error) {
+	return node("ConditionalExpr", expr.Span(), jsonNode{
+		"condition":  encodeExpr(expr.Condition),
+		"thenBranch": encodeExpr(expr.ThenBranch),
+		"elseBranch": encodeExpr(expr.ElseBranch),
+	}), nil
+}
+
+func (j jsonEncoder) VisitFunctionExpr(expr *FunctionExpr) (interface{}, error) {
+	return node("FunctionExpr", expr.Span(), jsonNode{
+		"params": encodeNames(expr.Params),
+		"body":   encodeStmts(expr.Body),
+	}), nil
+}
+
+func (j jsonEncoder) VisitGetExpr(expr *GetExpr) (interface{}, error) {
+	return node("GetExpr", expr.Span(), jsonNode{
+		"object": encodeExpr(expr.Object),
+		"name":   expr.Name.Lexeme,
+	}), nil
+}
+
+func (j jsonEncoder) VisitGroupingExpr(expr *GroupingExpr) (interface{}, error) {
+	return node("GroupingExpr", expr.Span(), jsonNode{
+		"expression": encodeExpr(expr.Expression),
+	}), nil
+}
+
+func (j jsonEncoder) VisitIncrementExpr(expr *IncrementExpr) (interface{}, error) {
+	return node("IncrementExpr", expr.Span(), jsonNode{
+		"operator": expr.Operator.Lexeme,
+		"prefix":   expr.Prefix,
+		"target":   encodeExpr(expr.Target),
+	}), nil
+}
+
+func (j jsonEncoder) VisitIndexExpr(expr *IndexExpr) (interface{}, error) {
+	return node("IndexExpr", expr.Span(), jsonNode{
+		"object": encodeExpr(expr.Object),
+		"index":  encodeExpr(expr.Index),
+	}), nil
+}
+
+func (j jsonEncoder) VisitIndexSetExpr(expr *IndexSetExpr) (interface{}, error) {
+	return node("IndexSetExpr", expr.Span(), jsonNode{
+		"object": encodeExpr(expr.Object),
+		"index":  encodeExpr(expr.Index),
+		"value":  encodeExpr(expr.Value),
+	}), nil
+}
+
+func (j jsonEncoder) VisitListExpr(expr *ListExpr) (interface{}, error) {
+	return node("ListExpr", expr.Span(), jsonNode{
+		"elements": encodeExprs(expr.Elements),
+	}), nil
+}
+
+func (j jsonEncoder) VisitLiteralExpr(expr *LiteralExpr) (interface{}, error) {
+	return node("LiteralExpr", expr.Span(), jsonNode{
+		"value": expr.Value,
+	}), nil
+}
+
+func (j jsonEncoder) VisitLogicalExpr(expr *LogicalExpr) (interface{}, error) {
+	return node("LogicalExpr", expr.Span(), jsonNode{
+		"operator": expr.Operator.Lexeme,
+		"left":     encodeExpr(expr.Left),
+		"right":    encodeExpr(expr.Right),
+	}), nil
+}
+
+func (j jsonEncoder) VisitMapExpr(expr *MapExpr) (interface{}, error) {
+	entries := make([]jsonNode, len(expr.Keys))
+	for i, key := range expr.Keys {
+		entries[i] = jsonNode{"key": encodeExpr(key), "value": encodeExpr(expr.Values[i])}
+	}
+	return node("MapExpr", expr.Span(), jsonNode{
+		"entries": entries,
+	}), nil
+}
+
+func (j jsonEncoder) VisitSetExpr(expr *SetExpr) (interface{}, error) {
+	return node("SetExpr", expr.Span(), jsonNode{
+		"object": encodeExpr(expr.Object),
+		"name":   expr.Name.Lexeme,
+		"value":  encodeExpr(expr.Value),
+	}), nil
+}
+
+func (j jsonEncoder) VisitSuperExpr(expr *SuperExpr) (interface{}, error) {
+	return node("SuperExpr", expr.Span(), jsonNode{
+		"method": expr.Method.Lexeme,
+	}), nil
+}
+
+func (j jsonEncoder) VisitThisExpr(expr *ThisExpr) (interface{}, error) {
+	return node("ThisExpr", expr.Span(), jsonNode{}), nil
+}
+
+func (j jsonEncoder) VisitUnaryExpr(expr *UnaryExpr) (interface{}, error) {
+	return node("UnaryExpr", expr.Span(), jsonNode{
+		"operator": expr.Operator.Lexeme,
+		"right":    encodeExpr(expr.Right),
+	}), nil
+}
+
+func (j jsonEncoder) VisitVariableExpr(expr *VariableExpr) (interface{}, error) {
+	return node("VariableExpr", expr.Span(), jsonNode{
+		"name": expr.Name.Lexeme,
+	}), nil
+}
+
+func (j jsonEncoder) VisitBlockStmt(stmt *BlockStmt) (interface{}, error) {
+	return node("BlockStmt", stmt.Span(), jsonNode{
+		"statements": encodeStmts(stmt.Statements),
+	}), nil
+}
+
+func (j jsonEncoder) VisitBreakStmt(stmt *BreakStmt) (interface{}, error) {
+	return node("BreakStmt", stmt.Span(), jsonNode{
+		"label": encodeLabel(stmt.Label),
+	}), nil
+}
+
+func (j jsonEncoder) VisitClassStmt(stmt *ClassStmt) (interface{}, error) {
+	var superclass interface{} = nil
+	if stmt.Superclass != nil {
+		superclass = stmt.Superclass.Name.Lexeme
+	}
+	methods := make([]interface{}, len(stmt.Methods))
+	for i, method := range stmt.Methods {
+		methods[i] = encodeStmt(method)
+	}
+	return node("ClassStmt", stmt.Span(), jsonNode{
+		"name":       stmt.Name.Lexeme,
+		"superclass": superclass,
+		"methods":    methods,
+	}), nil
+}
+
+func (j jsonEncoder) VisitContinueStmt(stmt *ContinueStmt) (interface{}, error) {
+	return node("ContinueStmt", stmt.Span(), jsonNode{
+		"label": encodeLabel(stmt.Label),
+	}), nil
+}
+
+func (j jsonEncoder) VisitExprStmt(stmt *ExprStmt) (interface{}, error) {
+	return node("ExprStmt", stmt.Span(), jsonNode{
+		"expression": encodeExpr(stmt.Expr),
+	}), nil
+}
+
+func (j jsonEncoder) VisitFunctionStmt(stmt *FunctionStmt) (interface{}, error) {
+	return node("FunctionStmt", stmt.Span(), jsonNode{
+		"name":   stmt.Name.Lexeme,
+		"params": encodeNames(stmt.Params),
+		"body":   encodeStmts(stmt.Body),
+	}), nil
+}
+
+func (j jsonEncoder) VisitIfStmt(stmt *IfStmt) (interface{}, error) {
+	return node("IfStmt", stmt.Span(), jsonNode{
+		"condition":  encodeExpr(stmt.Condition),
+		"thenBranch": encodeStmt(stmt.ThenBranch),
+		"elseBranch": encodeStmt(stmt.ElseBranch),
+	}), nil
+}
+
+func (j jsonEncoder) VisitPrintStmt(stmt *PrintStmt) (interface{}, error) {
+	return node("PrintStmt", stmt.Span(), jsonNode{
+		"expression": encodeExpr(stmt.Expr),
+	}), nil
+}
+
+func (j jsonEncoder) VisitReturnStmt(stmt *ReturnStmt) (interface{}, error) {
+	return node("ReturnStmt", stmt.Span(), jsonNode{
+		"value": encodeExpr(stmt.Value),
+	}), nil
+}
+
+func (j jsonEncoder) VisitSwitchStmt(stmt *SwitchStmt) (interface{}, error) {
+	cases := make([]jsonNode, len(stmt.Cases))
+	for i, clause := range stmt.Cases {
+		cases[i] = encodeSwitchCase(clause)
+	}
+	var defaultCase interface{} = nil
+	if stmt.Default != nil {
+		defaultCase = encodeSwitchCase(stmt.Default)
+	}
+	return node("SwitchStmt", stmt.Span(), jsonNode{
+		"subject": encodeExpr(stmt.Subject),
+		"cases":   cases,
+		"default": defaultCase,
+	}), nil
+}
+
+func encodeSwitchCase(clause *SwitchCase) jsonNode {
+	return node("SwitchCase", clause.Span(), jsonNode{
+		"values": encodeExprs(clause.Values),
+		"body":   encodeStmts(clause.Body),
+	})
+}
+
+func (j jsonEncoder) VisitVarDeclStmt(stmt *VarDeclStmt) (interface{}, error) {
+	return node("VarDeclStmt", stmt.Span(), jsonNode{
+		"name":        stmt.Name.Lexeme,
+		"initializer": encodeExpr(stmt.Initializer),
+		"const":       stmt.Const,
+	}), nil
+}
+
+func (j jsonEncoder) VisitWhileStmt(stmt *WhileStmt) (interface{}, error) {
+	return node("WhileStmt", stmt.Span(), jsonNode{
+		"label":     encodeLabel(stmt.Label),
+		"condition": encodeExpr(stmt.Condition),
+		"body":      encodeStmt(stmt.Body),
+		"increment": encodeExpr(stmt.Increment),
+	}), nil
+}
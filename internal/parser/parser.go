@@ -4,157 +4,322 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/codecrafters-io/interpreter-starter-go/internal/errorHand"
 	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
 )
 
 type Parser struct {
-	current int
-	tokens  []scanner.Token
+	current       int
+	tokens        []scanner.Token
+	functionDepth int
+	classDepth    int
+	inSubclass    bool
+	inInitializer bool
+	loopDepth     int
+	loopLabels    []string
+	allowBareExpr bool
 }
 
-type ExprType int
-type StmtType int
+// maxArgs is the most arguments a call, or parameters a function, can have.
+const maxArgs = 255
 
-const (
-	LITERAL ExprType = iota
-	UNARY
-	BINARY
-	GROUPING
-	ASSIGN
-	VARIABLE
-)
+func NewParser(tokens []scanner.Token) Parser {
+	return Parser{
+		current: 0,
+		tokens:  tokens,
+	}
+}
 
-const (
-	PRINT StmtType = iota
-	EXPR
-	VAR
-)
+// ParseStmts parses the whole program. Syntax errors are reported as they
+// are found and the statement holding them is dropped, so the returned slice
+// never contains nil statements; check errorHand.HadError afterwards.
+func (p *Parser) ParseStmts() []Statement {
+	var stmts []Statement
 
-type Statement interface {
-	StmtType() StmtType
-	Execute(i func())
+	for !p.isAtEnd() {
+		statement, err := p.declaration()
+		if err != nil {
+			p.synchronize()
+			continue
+		}
+
+		stmts = append(stmts, statement)
+	}
+
+	return stmts
 }
 
-type PrintStmt struct {
-	Expr *Node
+// ParseProgram works like ParseStmts, except that the last statement can be
+// an expression with no ';' after it. That lets the parse command take both
+// whole programs and a lone expression.
+func (p *Parser) ParseProgram() []Statement {
+	p.allowBareExpr = true
+	defer func() {
+		p.allowBareExpr = false
+	}()
+
+	return p.ParseStmts()
 }
 
-func (p PrintStmt) Execute(i func()) {
-	i()
+// ParseExpr parses a single expression, returning nil if it has a syntax
+// error.
+func (parser *Parser) ParseExpr() Expr {
+	expr, err := parser.expression()
+
+	if err != nil {
+		return nil
+	}
+	return expr
 }
 
-func (p PrintStmt) StmtType() StmtType {
-	return PRINT
+// ************************* AstPrinter section *************************
+
+// astPrinter is the ExprVisitor and StmtVisitor behind AstPrint and
+// AstPrintStmts. Every node prints as an S-expression headed by its
+// operator or keyword.
+type astPrinter struct{}
+
+func AstPrint(expr Expr) {
+	fmt.Println(stringify(expr))
 }
 
-type ExprStmt struct {
-	Expr *Node
+// AstPrintStmts prints every statement of a program on its own line. An
+// expression statement prints as its bare expression, so a program made of
+// a single expression prints the same as AstPrint does.
+func AstPrintStmts(stmts []Statement) {
+	for _, stmt := range stmts {
+		fmt.Println(stringifyStmt(stmt))
+	}
 }
 
-func (e ExprStmt) Execute(i func()) {
-	i()
+func stringify(expr Expr) string {
+	text, _ := expr.Accept(astPrinter{})
+	return text.(string)
 }
 
-func (p ExprStmt) StmtType() StmtType {
-	return EXPR
+func stringifyStmt(stmt Statement) string {
+	text, _ := stmt.Accept(astPrinter{})
+	return text.(string)
 }
 
-type VarDeclStmt struct {
-	Name        scanner.Token
-	Initializer *Node
+func (a astPrinter) VisitBinaryExpr(expr *BinaryExpr) (interface{}, error) {
+	return parenthesize(expr.Operator.Lexeme + " " + stringify(expr.Left) + " " + stringify(expr.Right)), nil
 }
 
-func (v VarDeclStmt) Execute(i func()) {
-	i()
+func (a astPrinter) VisitLogicalExpr(expr *LogicalExpr) (interface{}, error) {
+	return parenthesize(expr.Operator.Lexeme + " " + stringify(expr.Left) + " " + stringify(expr.Right)), nil
 }
 
-func (v VarDeclStmt) StmtType() StmtType {
-	return VAR
+func (a astPrinter) VisitConditionalExpr(expr *ConditionalExpr) (interface{}, error) {
+	return parenthesize("?: " + stringify(expr.Condition) + " " + stringify(expr.ThenBranch) + " " +
+		stringify(expr.ElseBranch)), nil
 }
 
-func (e ExprType) toString() string {
-	return []string{"LITERAL", "UNARY", "BINARY", "GROUPING"}[e]
+func (a astPrinter) VisitFunctionExpr(expr *FunctionExpr) (interface{}, error) {
+	return parenthesize("fun " + stringifyParams(expr.Params) + stringifyBody(expr.Body)), nil
 }
 
-type Node struct {
-	Value    scanner.Token
-	ExprType ExprType
-	Left     *Node
-	Right    *Node
+func (a astPrinter) VisitListExpr(expr *ListExpr) (interface{}, error) {
+	text := "list"
+	for _, element := range expr.Elements {
+		text += " " + stringify(element)
+	}
+	return parenthesize(text), nil
 }
 
-func newNode(token scanner.Token, exprType ExprType, left, right *Node) *Node {
-	return &Node{
-		Value:    token,
-		ExprType: exprType,
-		Left:     left,
-		Right:    right,
+func (a astPrinter) VisitMapExpr(expr *MapExpr) (interface{}, error) {
+	text := "map"
+	for i, key := range expr.Keys {
+		text += " " + stringify(key) + " " + stringify(expr.Values[i])
 	}
+	return parenthesize(text), nil
 }
 
-func NewParser(tokens []scanner.Token) Parser {
-	return Parser{
-		current: 0,
-		tokens:  tokens,
+func (a astPrinter) VisitIndexExpr(expr *IndexExpr) (interface{}, error) {
+	return parenthesize("index " + stringify(expr.Object) + " " + stringify(expr.Index)), nil
+}
+
+func (a astPrinter) VisitIndexSetExpr(expr *IndexSetExpr) (interface{}, error) {
+	return parenthesize("index-set " + stringify(expr.Object) + " " + stringify(expr.Index) + " " +
+		stringify(expr.Value)), nil
+}
+
+func (a astPrinter) VisitCompoundAssignExpr(expr *CompoundAssignExpr) (interface{}, error) {
+	return parenthesize(expr.Operator.Lexeme + " " + stringify(expr.Target) + " " + stringify(expr.Value)), nil
+}
+
+func (a astPrinter) VisitIncrementExpr(expr *IncrementExpr) (interface{}, error) {
+	if expr.Prefix {
+		return parenthesize("pre" + expr.Operator.Lexeme + " " + stringify(expr.Target)), nil
 	}
+	return parenthesize("post" + expr.Operator.Lexeme + " " + stringify(expr.Target)), nil
 }
 
-func (p *Parser) ParseStmts() []Statement {
-	var stmts []Statement
+func (a astPrinter) VisitLiteralExpr(expr *LiteralExpr) (interface{}, error) {
+	if expr.Token.TokenType == scanner.NUMBER {
+		return stringifyNumber(expr.Token.Lexeme), nil
+	} else if expr.Token.TokenType == scanner.STRING {
+		return expr.Token.Lexeme[1 : len(expr.Token.Lexeme)-1], nil
+	}
+	return expr.Token.Lexeme, nil
+}
 
-	for !p.isAtEnd() {
-		statement, err := p.declaration()
-		if err != nil {
-			fmt.Println("error")
-		}
+func (a astPrinter) VisitGroupingExpr(expr *GroupingExpr) (interface{}, error) {
+	return "(group " + stringify(expr.Expression) + ")", nil
+}
 
-		stmts = append(stmts, statement)
+func (a astPrinter) VisitUnaryExpr(expr *UnaryExpr) (interface{}, error) {
+	return parenthesize(expr.Operator.Lexeme + " " + stringify(expr.Right)), nil
+}
+
+func (a astPrinter) VisitVariableExpr(expr *VariableExpr) (interface{}, error) {
+	return expr.Name.Lexeme, nil
+}
+
+func (a astPrinter) VisitAssignExpr(expr *AssignExpr) (interface{}, error) {
+	return parenthesize("assign " + expr.Name.Lexeme + " " + stringify(expr.Value)), nil
+}
+
+func (a astPrinter) VisitCallExpr(expr *CallExpr) (interface{}, error) {
+	text := "call " + stringify(expr.Callee)
+	for _, arg := range expr.Arguments {
+		text += " " + stringify(arg)
 	}
+	return parenthesize(text), nil
+}
 
-	return stmts
+func (a astPrinter) VisitGetExpr(expr *GetExpr) (interface{}, error) {
+	return parenthesize("get " + stringify(expr.Object) + " " + expr.Name.Lexeme), nil
 }
 
-func (parser *Parser) ParseExpr() *Node {
-	expr, err := parser.expression()
+func (a astPrinter) VisitSetExpr(expr *SetExpr) (interface{}, error) {
+	return parenthesize("set " + stringify(expr.Object) + " " + expr.Name.Lexeme + " " + stringify(expr.Value)), nil
+}
 
-	if err != nil {
-		errorHand.ParseError(parser.tokens[parser.current].Lexeme,
-			parser.tokens[parser.current].Line,
-			err.Error())
+func (a astPrinter) VisitSuperExpr(expr *SuperExpr) (interface{}, error) {
+	return parenthesize("super " + expr.Method.Lexeme), nil
+}
+
+func (a astPrinter) VisitThisExpr(expr *ThisExpr) (interface{}, error) {
+	return expr.Keyword.Lexeme, nil
+}
+
+func (a astPrinter) VisitExprStmt(stmt *ExprStmt) (interface{}, error) {
+	return stringify(stmt.Expr), nil
+}
+
+func (a astPrinter) VisitPrintStmt(stmt *PrintStmt) (interface{}, error) {
+	return parenthesize("print " + stringify(stmt.Expr)), nil
+}
+
+func (a astPrinter) VisitVarDeclStmt(stmt *VarDeclStmt) (interface{}, error) {
+	if stmt.Const {
+		return parenthesize("const " + stmt.Name.Lexeme + " " + stringify(stmt.Initializer)), nil
 	}
-	return expr
+	if stmt.Initializer == nil {
+		return parenthesize("var " + stmt.Name.Lexeme), nil
+	}
+	return parenthesize("var " + stmt.Name.Lexeme + " " + stringify(stmt.Initializer)), nil
 }
 
-// ************************* AstPrinter section *************************
+func (a astPrinter) VisitBlockStmt(stmt *BlockStmt) (interface{}, error) {
+	return parenthesize("block" + stringifyBody(stmt.Statements)), nil
+}
 
-func AstPrint(expr *Node) {
-	fmt.Println(stringify(expr))
+func (a astPrinter) VisitIfStmt(stmt *IfStmt) (interface{}, error) {
+	text := "if " + stringify(stmt.Condition) + " " + stringifyStmt(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		text += " " + stringifyStmt(stmt.ElseBranch)
+	}
+	return parenthesize(text), nil
+}
+
+// VisitWhileStmt prints the increment of a desugared for loop after the
+// body, and wraps labeled loops in a (label name ...) form.
+func (a astPrinter) VisitWhileStmt(stmt *WhileStmt) (interface{}, error) {
+	text := parenthesize("while " + stringify(stmt.Condition) + " " + stringifyStmt(stmt.Body))
+	if stmt.Increment != nil {
+		text = parenthesize("while " + stringify(stmt.Condition) + " " + stringifyStmt(stmt.Body) + " " +
+			stringify(stmt.Increment))
+	}
+	if stmt.Label != nil {
+		text = parenthesize("label " + stmt.Label.Lexeme + " " + text)
+	}
+	return text, nil
 }
 
-func stringify(expr *Node) string {
-	switch expr.ExprType {
-	case BINARY:
-		return parenthesize(stringifyBinary(expr))
-	case LITERAL:
-		if expr.Value.TokenType == scanner.NUMBER {
-			return stringifyNumber(expr.Value.Lexeme)
-		} else if expr.Value.TokenType == scanner.STRING {
-			return expr.Value.Lexeme[1 : len(expr.Value.Lexeme)-1]
+func (a astPrinter) VisitBreakStmt(stmt *BreakStmt) (interface{}, error) {
+	if stmt.Label != nil {
+		return parenthesize("break " + stmt.Label.Lexeme), nil
+	}
+	return "(break)", nil
+}
+
+func (a astPrinter) VisitContinueStmt(stmt *ContinueStmt) (interface{}, error) {
+	if stmt.Label != nil {
+		return parenthesize("continue " + stmt.Label.Lexeme), nil
+	}
+	return "(continue)", nil
+}
+
+func (a astPrinter) VisitFunctionStmt(stmt *FunctionStmt) (interface{}, error) {
+	return parenthesize("fun " + stmt.Name.Lexeme + " " + stringifyParams(stmt.Params) + stringifyBody(stmt.Body)), nil
+}
+
+func (a astPrinter) VisitReturnStmt(stmt *ReturnStmt) (interface{}, error) {
+	if stmt.Value == nil {
+		return "(return)", nil
+	}
+	return parenthesize("return " + stringify(stmt.Value)), nil
+}
+
+// VisitSwitchStmt prints each case as (case (values...) body...) and the
+// default clause as (default body...).
+func (a astPrinter) VisitSwitchStmt(stmt *SwitchStmt) (interface{}, error) {
+	text := "switch " + stringify(stmt.Subject)
+	for _, clause := range stmt.Cases {
+		values := make([]string, len(clause.Values))
+		for i, value := range clause.Values {
+			values[i] = stringify(value)
 		}
-		return expr.Value.Lexeme
-	case GROUPING:
-		return stringifyGroup(expr)
-	case UNARY:
-		return stringifyUnary(expr)
-	default:
-		return expr.Value.Lexeme
+		text += " " + parenthesize("case "+parenthesize(strings.Join(values, " "))+stringifyBody(clause.Body))
+	}
+	if stmt.Default != nil {
+		text += " " + parenthesize("default"+stringifyBody(stmt.Default.Body))
+	}
+	return parenthesize(text), nil
+}
+
+func (a astPrinter) VisitClassStmt(stmt *ClassStmt) (interface{}, error) {
+	text := "class " + stmt.Name.Lexeme
+	if stmt.Superclass != nil {
+		text += " < " + stmt.Superclass.Name.Lexeme
+	}
+	for _, method := range stmt.Methods {
+		text += " " + stringifyStmt(method)
+	}
+	return parenthesize(text), nil
+}
+
+// stringifyParams prints a parameter list as "(a b c)".
+func stringifyParams(params []scanner.Token) string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.Lexeme
 	}
+	return parenthesize(strings.Join(names, " "))
 }
 
-func stringifyBinary(expr *Node) string {
-	return expr.Value.Lexeme + " " + stringify(expr.Left) + " " + stringify(expr.Right)
+// stringifyBody prints each statement preceded by a space, ready to be
+// appended after the head of an S-expression.
+func stringifyBody(stmts []Statement) string {
+	text := ""
+	for _, stmt := range stmts {
+		text += " " + stringifyStmt(stmt)
+	}
+	return text
 }
 
 func stringifyNumber(number string) string {
@@ -166,17 +331,6 @@ func stringifyNumber(number string) string {
 	return fmt.Sprintf("%.1f", numf)
 }
 
-func stringifyGroup(expr *Node) string {
-	if expr.Left != nil {
-		return "(group " + stringify(expr.Left) + ")"
-	}
-	return ""
-}
-
-func stringifyUnary(expr *Node) string {
-	return parenthesize(expr.Value.Lexeme + " " + stringify(expr.Right))
-}
-
 func parenthesize(text string) string {
 	return "(" + text + ")"
 }
@@ -184,212 +338,1090 @@ func parenthesize(text string) string {
 // **********************************************************************
 
 func (p *Parser) declaration() (Statement, error) {
+	start := p.peek()
+	var stmt Statement
+	var err error
+
 	if p.match(scanner.VAR) {
-		return p.varDeclarationStmt(), nil
+		stmt, err = p.varDeclarationStmt(false)
+	} else if p.match(scanner.CONST) {
+		stmt, err = p.varDeclarationStmt(true)
+	} else if p.check(scanner.FUN) && p.checkNext(scanner.IDENTIFIER) {
+		p.advance()
+		stmt, err = p.function("function")
+	} else if p.match(scanner.CLASS) {
+		stmt, err = p.classDeclaration()
+	} else {
+		stmt, err = p.statement()
 	}
-	return p.statement()
+
+	if err != nil {
+		return nil, err
+	}
+	stmt.setSpan(p.spanFrom(start))
+	return stmt, nil
 }
 
 func (p *Parser) statement() (Statement, error) {
+	start := p.peek()
+	var stmt Statement
+	var err error
+
 	if p.match(scanner.PRINT) {
-		return p.printStmt(), nil
+		stmt, err = p.printStmt()
+	} else if p.match(scanner.IF) {
+		stmt, err = p.ifStmt()
+	} else if p.match(scanner.WHILE) {
+		stmt, err = p.whileStmt(nil)
+	} else if p.match(scanner.FOR) {
+		stmt, err = p.forStmt(nil)
+	} else if p.match(scanner.SWITCH) {
+		stmt, err = p.switchStmt()
+	} else if p.match(scanner.RETURN) {
+		stmt, err = p.returnStmt()
+	} else if p.match(scanner.BREAK) {
+		stmt, err = p.breakStmt()
+	} else if p.match(scanner.CONTINUE) {
+		stmt, err = p.continueStmt()
+	} else if p.check(scanner.IDENTIFIER) && p.checkNext(scanner.COLON) {
+		stmt, err = p.labeledStmt()
+	} else if !p.isMapLiteral() && p.match(scanner.LEFT_BRACE) {
+		var stmts []Statement
+		stmts, err = p.block()
+		stmt = &BlockStmt{Statements: stmts}
 	} else {
-		return p.exprStmt(), nil
+		stmt, err = p.exprStmt()
+	}
+
+	if err != nil {
+		return nil, err
 	}
-	//return nil, nil
+	stmt.setSpan(p.spanFrom(start))
+	return stmt, nil
 }
 
-func (p *Parser) printStmt() Statement {
-	expr := p.ParseExpr()
-	p.consume(scanner.SEMICOLON, "expect ';'")
+func (p *Parser) printStmt() (Statement, error) {
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
 
-	return PrintStmt{Expr: expr}
+	_, err = p.consume(scanner.SEMICOLON, "Expect ';' after value.")
+	if err != nil {
+		return nil, err
+	}
+	return &PrintStmt{Expr: expr}, nil
 }
 
-func (p *Parser) exprStmt() Statement {
-	expr := p.ParseExpr()
-	p.consume(scanner.SEMICOLON, "expect ';'")
-	return ExprStmt{Expr: expr}
+func (p *Parser) exprStmt() (Statement, error) {
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.allowBareExpr && p.isAtEnd() {
+		return &ExprStmt{Expr: expr}, nil
+	}
+
+	_, err = p.consume(scanner.SEMICOLON, "Expect ';' after expression.")
+	if err != nil {
+		return nil, err
+	}
+	return &ExprStmt{Expr: expr}, nil
 }
 
-func (p *Parser) varDeclarationStmt() Statement {
-	name, _ := p.consume(scanner.IDENTIFIER, "Expect identifier after 'var'")
-	var initializer *Node = nil
-	if p.match(scanner.EQUAL) {
-		initializer, _ = p.expression()
+func (p *Parser) classDeclaration() (Statement, error) {
+	name, err := p.consume(scanner.IDENTIFIER, "Expect class name.")
+	if err != nil {
+		return nil, err
 	}
-	p.consume(scanner.SEMICOLON, "Expect ';' after variable declaration.")
-	return VarDeclStmt{
-		Name:        name,
-		Initializer: initializer,
+
+	var superclass *VariableExpr = nil
+	if p.match(scanner.LESS) {
+		superName, err := p.consume(scanner.IDENTIFIER, "Expect superclass name.")
+		if err != nil {
+			return nil, err
+		}
+		if superName.Lexeme == name.Lexeme {
+			errorHand.ParseError(superName.Lexeme, superName.Line, "A class can't inherit from itself.")
+		}
+		superclass = &VariableExpr{Name: superName}
+		superclass.setSpan(superName.Span)
 	}
+
+	_, err = p.consume(scanner.LEFT_BRACE, "Expect '{' before class body.")
+	if err != nil {
+		return nil, err
+	}
+
+	enclosingSubclass := p.inSubclass
+	p.inSubclass = superclass != nil
+	p.classDepth++
+	defer func() {
+		p.classDepth--
+		p.inSubclass = enclosingSubclass
+	}()
+
+	var methods []*FunctionStmt
+	for !p.check(scanner.RIGHT_BRACE) && !p.isAtEnd() {
+		start := p.peek()
+		method, err := p.function("method")
+		if err != nil {
+			return nil, err
+		}
+		method.setSpan(p.spanFrom(start))
+		methods = append(methods, method)
+	}
+
+	_, err = p.consume(scanner.RIGHT_BRACE, "Expect '}' after class body.")
+	if err != nil {
+		return nil, err
+	}
+	return &ClassStmt{Name: name, Superclass: superclass, Methods: methods}, nil
 }
 
-func (parser *Parser) expression() (*Node, error) {
-	expr, err := parser.assignment()
+func (p *Parser) function(kind string) (*FunctionStmt, error) {
+	name, err := p.consume(scanner.IDENTIFIER, "Expect "+kind+" name.")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(scanner.LEFT_PAREN, "Expect '(' after "+kind+" name.")
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := p.parameters()
 	if err != nil {
 		return nil, err
 	}
-	return expr, nil
+
+	_, err = p.consume(scanner.LEFT_BRACE, "Expect '{' before "+kind+" body.")
+	if err != nil {
+		return nil, err
+	}
+
+	leave := p.enterFunction(kind == "method" && name.Lexeme == "init")
+	body, err := p.block()
+	leave()
+	if err != nil {
+		return nil, err
+	}
+
+	return &FunctionStmt{Name: name, Params: params, Body: body}, nil
 }
 
-func (parser *Parser) assignment() (*Node, error) {
-	expr, err := parser.equality()
+// parameters parses a parameter list up to and including the closing ')'.
+func (p *Parser) parameters() ([]scanner.Token, error) {
+	var params []scanner.Token
+	if !p.check(scanner.RIGHT_PAREN) {
+		for {
+			if len(params) >= maxArgs {
+				errorHand.ParseError(p.peek().Lexeme, p.peek().Line,
+					"Can't have more than 255 parameters.")
+			}
+
+			param, err := p.consume(scanner.IDENTIFIER, "Expect parameter name.")
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, param)
+
+			if !p.match(scanner.COMMA) {
+				break
+			}
+		}
+	}
+
+	_, err := p.consume(scanner.RIGHT_PAREN, "Expect ')' after parameters.")
 	if err != nil {
 		return nil, err
 	}
+	return params, nil
+}
+
+// enterFunction sets the parser state up for a new function body and
+// returns the func that puts the enclosing state back. Loops outside the
+// function can't be the target of a break inside it.
+func (p *Parser) enterFunction(isInitializer bool) func() {
+	enclosingInitializer := p.inInitializer
+	enclosingLoopDepth, enclosingLabels := p.loopDepth, p.loopLabels
+	p.inInitializer = isInitializer
+	p.loopDepth, p.loopLabels = 0, nil
+	p.functionDepth++
+
+	return func() {
+		p.functionDepth--
+		p.inInitializer = enclosingInitializer
+		p.loopDepth, p.loopLabels = enclosingLoopDepth, enclosingLabels
+	}
+}
+
+func (p *Parser) returnStmt() (Statement, error) {
+	keyword := p.previous()
+	if p.functionDepth == 0 {
+		errorHand.ParseError(keyword.Lexeme, keyword.Line, "Can't return from top-level code.")
+	}
 
-	if parser.match(scanner.EQUAL) {
-		equal := parser.previous()
-		value, err := parser.assignment()
+	var value Expr = nil
+	if !p.check(scanner.SEMICOLON) {
+		if p.inInitializer {
+			errorHand.ParseError(keyword.Lexeme, keyword.Line,
+				"Can't return a value from an initializer.")
+		}
+		var err error
+		value, err = p.expression()
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	_, err := p.consume(scanner.SEMICOLON, "Expect ';' after return value.")
+	if err != nil {
+		return nil, err
+	}
+	return &ReturnStmt{Keyword: keyword, Value: value}, nil
+}
+
+func (p *Parser) breakStmt() (Statement, error) {
+	keyword := p.previous()
+	label := p.jumpTarget(keyword)
+
+	_, err := p.consume(scanner.SEMICOLON, "Expect ';' after 'break'.")
+	if err != nil {
+		return nil, err
+	}
+	return &BreakStmt{Keyword: keyword, Label: label}, nil
+}
+
+func (p *Parser) continueStmt() (Statement, error) {
+	keyword := p.previous()
+	label := p.jumpTarget(keyword)
+
+	_, err := p.consume(scanner.SEMICOLON, "Expect ';' after 'continue'.")
+	if err != nil {
+		return nil, err
+	}
+	return &ContinueStmt{Keyword: keyword, Label: label}, nil
+}
+
+// jumpTarget parses the optional label after break or continue and checks
+// that there is a loop, with that label if one was given, to jump out of.
+func (p *Parser) jumpTarget(keyword scanner.Token) *scanner.Token {
+	if p.loopDepth == 0 {
+		errorHand.ParseError(keyword.Lexeme, keyword.Line,
+			"Can't use '"+keyword.Lexeme+"' outside of a loop.")
+	}
 
-		if expr.ExprType == VARIABLE {
-			name := expr.Value
-			return newNode(name, ASSIGN, value, nil), nil
+	if !p.match(scanner.IDENTIFIER) {
+		return nil
+	}
+
+	label := p.previous()
+	for _, name := range p.loopLabels {
+		if name == label.Lexeme {
+			return &label
 		}
-		errorHand.Error(equal.Line, "Invalid assignment target.")
-		return nil, errors.New("invalid assignment target")
 	}
-	return expr, nil
+	if p.loopDepth > 0 {
+		errorHand.ParseError(label.Lexeme, label.Line, "Undefined label '"+label.Lexeme+"'.")
+	}
+	return &label
 }
 
-func (parser *Parser) equality() (*Node, error) {
-	expr, err := parser.comparisson()
+// labeledStmt parses "name: loop", where the loop is a while or a for.
+func (p *Parser) labeledStmt() (Statement, error) {
+	label := p.advance()
+	p.advance()
+
+	if p.match(scanner.WHILE) {
+		return p.whileStmt(&label)
+	}
+	if p.match(scanner.FOR) {
+		return p.forStmt(&label)
+	}
+	return nil, p.error(p.peek(), "Expect loop after label.")
+}
+
+// loopBody parses the body of a loop, keeping track of the loop so break
+// and continue inside it can be checked.
+func (p *Parser) loopBody(label *scanner.Token) (Statement, error) {
+	enclosingLabels := p.loopLabels
+	if label != nil {
+		p.loopLabels = append(p.loopLabels, label.Lexeme)
+	}
+	p.loopDepth++
+	defer func() {
+		p.loopDepth--
+		p.loopLabels = enclosingLabels
+	}()
+
+	return p.statement()
+}
 
+func (p *Parser) ifStmt() (Statement, error) {
+	condition, err := p.parenCondition("if")
 	if err != nil {
 		return nil, err
 	}
 
-	for parser.match(scanner.LESS, scanner.LESS_EQUAL, scanner.GREATER, scanner.GREATER_EQUAL) {
-		operator := parser.previous()
-		right, err := parser.comparisson()
+	thenBranch, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
 
+	// the else binds to the nearest if, which resolves the dangling else
+	var elseBranch Statement = nil
+	if p.match(scanner.ELSE) {
+		elseBranch, err = p.statement()
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	return &IfStmt{
+		Condition:  condition,
+		ThenBranch: thenBranch,
+		ElseBranch: elseBranch,
+	}, nil
+}
 
-		expr = newNode(operator, BINARY, expr, right)
+func (p *Parser) whileStmt(label *scanner.Token) (Statement, error) {
+	condition, err := p.parenCondition("while")
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.loopBody(label)
+	if err != nil {
+		return nil, err
 	}
 
-	return expr, nil
+	return &WhileStmt{Label: label, Condition: condition, Body: body}, nil
 }
 
-func (parser *Parser) comparisson() (*Node, error) {
-	expr, err := parser.term()
+// forStmt desugars a for loop into a while loop wrapped in a block holding
+// the initializer, so the interpreter does not need to know about for loops
+// at all.
+func (p *Parser) forStmt(label *scanner.Token) (Statement, error) {
+	keyword := p.previous()
+	_, err := p.consume(scanner.LEFT_PAREN, "Expect '(' after 'for'.")
+	if err != nil {
+		return nil, err
+	}
 
+	initStart := p.peek()
+	var initializer Statement = nil
+	if p.match(scanner.SEMICOLON) {
+		initializer = nil
+	} else if p.match(scanner.VAR) {
+		initializer, err = p.varDeclarationStmt(false)
+	} else {
+		initializer, err = p.exprStmt()
+	}
 	if err != nil {
 		return nil, err
 	}
+	if initializer != nil {
+		initializer.setSpan(p.spanFrom(initStart))
+	}
 
-	for parser.match(scanner.EQUAL_EQUAL, scanner.BANG_EQUAL) {
-		operator := parser.previous()
-		right, err := parser.term()
+	var condition Expr = nil
+	if !p.check(scanner.SEMICOLON) {
+		condition, err = p.expression()
+		if err != nil {
+			return nil, err
+		}
+	}
+	conditionEnd, err := p.consume(scanner.SEMICOLON, "Expect ';' after loop condition.")
+	if err != nil {
+		return nil, err
+	}
 
+	var increment Expr = nil
+	if !p.check(scanner.RIGHT_PAREN) {
+		increment, err = p.expression()
 		if err != nil {
 			return nil, err
 		}
+	}
+	_, err = p.consume(scanner.RIGHT_PAREN, "Expect ')' after for clauses.")
+	if err != nil {
+		return nil, err
+	}
 
-		expr = newNode(operator, BINARY, expr, right)
+	body, err := p.loopBody(label)
+	if err != nil {
+		return nil, err
+	}
+
+	// the desugared nodes get the span of the source they stand for
+	if condition == nil {
+		condition = withSpan(&LiteralExpr{
+			Token: scanner.Token{
+				Line:      conditionEnd.Line,
+				Lexeme:    "true",
+				Literal:   "null",
+				TokenType: scanner.TRUE,
+				Span:      conditionEnd.Span,
+			},
+			Value: true,
+		}, conditionEnd.Span)
+	}
+	body = &WhileStmt{Label: label, Condition: condition, Body: body, Increment: increment}
+	body.setSpan(p.spanFrom(keyword))
+	if initializer != nil {
+		body = &BlockStmt{Statements: []Statement{initializer, body}}
+		body.setSpan(p.spanFrom(keyword))
 	}
 
-	return expr, nil
+	return body, nil
 }
 
-func (parser *Parser) term() (*Node, error) {
-	expr, err := parser.factor()
+// switchStmt parses the switch once the 'switch' has been matched. The
+// default clause can go anywhere among the cases, but only once.
+func (p *Parser) switchStmt() (Statement, error) {
+	keyword := p.previous()
+	subject, err := p.parenCondition("switch")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(scanner.LEFT_BRACE, "Expect '{' before switch body.")
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &SwitchStmt{Keyword: keyword, Subject: subject}
+	for !p.check(scanner.RIGHT_BRACE) && !p.isAtEnd() {
+		start := p.peek()
+		clause := &SwitchCase{}
+
+		if p.match(scanner.CASE) {
+			for {
+				value, err := p.expression()
+				if err != nil {
+					return nil, err
+				}
+				clause.Values = append(clause.Values, value)
+
+				if !p.match(scanner.COMMA) {
+					break
+				}
+			}
+			_, err = p.consume(scanner.COLON, "Expect ':' after case values.")
+			if err != nil {
+				return nil, err
+			}
+			stmt.Cases = append(stmt.Cases, clause)
+		} else if p.match(scanner.DEFAULT) {
+			if stmt.Default != nil {
+				errorHand.ParseError(start.Lexeme, start.Line, "Can't have more than one 'default' in a switch.")
+			}
+			_, err = p.consume(scanner.COLON, "Expect ':' after 'default'.")
+			if err != nil {
+				return nil, err
+			}
+			stmt.Default = clause
+		} else {
+			return nil, p.error(p.peek(), "Expect 'case' or 'default' in switch body.")
+		}
+
+		// the body runs up to the next clause; there is no fallthrough
+		for !p.check(scanner.CASE) && !p.check(scanner.DEFAULT) &&
+			!p.check(scanner.RIGHT_BRACE) && !p.isAtEnd() {
+			bodyStmt, err := p.declaration()
+			if err != nil {
+				p.synchronize()
+				continue
+			}
+			clause.Body = append(clause.Body, bodyStmt)
+		}
+		clause.setSpan(p.spanFrom(start))
+	}
+
+	_, err = p.consume(scanner.RIGHT_BRACE, "Expect '}' after switch body.")
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parenCondition(keyword string) (Expr, error) {
+	_, err := p.consume(scanner.LEFT_PAREN, "Expect '(' after '"+keyword+"'.")
+	if err != nil {
+		return nil, err
+	}
+
+	condition, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(scanner.RIGHT_PAREN, "Expect ')' after "+keyword+" condition.")
+	if err != nil {
+		return nil, err
+	}
+	return condition, nil
+}
+
+func (p *Parser) block() ([]Statement, error) {
+	var stmts []Statement
+
+	for !p.check(scanner.RIGHT_BRACE) && !p.isAtEnd() {
+		stmt, err := p.declaration()
+		if err != nil {
+			p.synchronize()
+			continue
+		}
+		stmts = append(stmts, stmt)
+	}
 
+	_, err := p.consume(scanner.RIGHT_BRACE, "Expect '}' after block.")
 	if err != nil {
 		return nil, err
 	}
+	return stmts, nil
+}
+
+// varDeclarationStmt parses a var, or a const when isConst is set, once the
+// keyword has been matched. A const must have an initializer.
+func (p *Parser) varDeclarationStmt(isConst bool) (Statement, error) {
+	kind := "variable"
+	if isConst {
+		kind = "constant"
+	}
 
-	for parser.match(scanner.PLUS, scanner.MINUS) {
-		operator := parser.previous()
-		right, err := parser.factor()
+	name, err := p.consume(scanner.IDENTIFIER, "Expect "+kind+" name.")
+	if err != nil {
+		return nil, err
+	}
 
+	var initializer Expr = nil
+	if isConst {
+		_, err = p.consume(scanner.EQUAL, "Expect '=' after constant name.")
 		if err != nil {
 			return nil, err
 		}
+	}
+	if isConst || p.match(scanner.EQUAL) {
+		initializer, err = p.expression()
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		expr = newNode(operator, BINARY, expr, right)
+	_, err = p.consume(scanner.SEMICOLON, "Expect ';' after "+kind+" declaration.")
+	if err != nil {
+		return nil, err
 	}
+	return &VarDeclStmt{
+		Name:        name,
+		Initializer: initializer,
+		Const:       isConst,
+	}, nil
+}
+
+// precedence is the binding power of an operator: the higher it is, the
+// tighter the operator binds its operands.
+type precedence int
+
+const (
+	precNone precedence = iota
+	precAssignment
+	precConditional
+	precOr
+	precAnd
+	precEquality
+	precComparison
+	precTerm
+	precFactor
+	precUnary
+	precPower
+	precPostfix
+	precCall
+)
+
+// operatorKind says which node an infix operator builds.
+type operatorKind int
 
-	return expr, nil
+const (
+	binaryOp operatorKind = iota
+	logicalOp
+	assignOp
+	compoundAssignOp
+	conditionalOp
+	postfixOp
+	callOp
+	getOp
+	indexOp
+)
+
+type infixOperator struct {
+	precedence precedence
+	rightAssoc bool
+	kind       operatorKind
 }
 
-func (parser *Parser) factor() (*Node, error) {
-	expr, err := parser.unary()
+// infixOperators is the table driving the expression parser: every token
+// that can follow an operand, with its precedence and associativity.
+var infixOperators = map[scanner.TokenType]infixOperator{
+	scanner.EQUAL:         {precAssignment, true, assignOp},
+	scanner.PLUS_EQUAL:    {precAssignment, true, compoundAssignOp},
+	scanner.MINUS_EQUAL:   {precAssignment, true, compoundAssignOp},
+	scanner.STAR_EQUAL:    {precAssignment, true, compoundAssignOp},
+	scanner.SLASH_EQUAL:   {precAssignment, true, compoundAssignOp},
+	scanner.QUESTION_MARK: {precConditional, true, conditionalOp},
+	scanner.OR:            {precOr, false, logicalOp},
+	scanner.AND:           {precAnd, false, logicalOp},
+	scanner.EQUAL_EQUAL:   {precEquality, false, binaryOp},
+	scanner.BANG_EQUAL:    {precEquality, false, binaryOp},
+	scanner.LESS:          {precComparison, false, binaryOp},
+	scanner.LESS_EQUAL:    {precComparison, false, binaryOp},
+	scanner.GREATER:       {precComparison, false, binaryOp},
+	scanner.GREATER_EQUAL: {precComparison, false, binaryOp},
+	scanner.PLUS:          {precTerm, false, binaryOp},
+	scanner.MINUS:         {precTerm, false, binaryOp},
+	scanner.STAR:          {precFactor, false, binaryOp},
+	scanner.SLASH:         {precFactor, false, binaryOp},
+	scanner.PERCENT:       {precFactor, false, binaryOp},
+	scanner.STAR_STAR:     {precPower, true, binaryOp},
+	scanner.PLUS_PLUS:     {precPostfix, false, postfixOp},
+	scanner.MINUS_MINUS:   {precPostfix, false, postfixOp},
+	scanner.LEFT_PAREN:    {precCall, false, callOp},
+	scanner.DOT:           {precCall, false, getOp},
+	scanner.LEFT_BRACKET:  {precCall, false, indexOp},
+}
 
+// prefixOperators maps each prefix operator to the precedence its operand is
+// parsed at. Unary minus takes a power as operand, so -2 ** 2 is -(2 ** 2),
+// while a prefix increment only takes a call, so ++x ** 2 is (++x) ** 2.
+var prefixOperators = map[scanner.TokenType]precedence{
+	scanner.BANG:        precUnary,
+	scanner.MINUS:       precUnary,
+	scanner.PLUS_PLUS:   precPostfix,
+	scanner.MINUS_MINUS: precPostfix,
+}
+
+func (parser *Parser) expression() (Expr, error) {
+	return parser.parsePrecedence(precAssignment)
+}
+
+// parsePrecedence parses an expression made of operators that bind at least
+// as tight as minPrecedence.
+func (parser *Parser) parsePrecedence(minPrecedence precedence) (Expr, error) {
+	expr, err := parser.prefix()
 	if err != nil {
 		return nil, err
 	}
 
-	for parser.match(scanner.SLASH, scanner.STAR) {
-		operator := parser.previous()
-		right, err := parser.unary()
+	for {
+		operator, ok := infixOperators[parser.peek().TokenType]
+		if !ok || operator.precedence < minPrecedence {
+			return expr, nil
+		}
 
+		expr, err = parser.infix(expr, parser.advance(), operator)
 		if err != nil {
 			return nil, err
 		}
+	}
+}
+
+// rightOperand parses the operand on the right of operator. A left
+// associative operator only takes tighter operators in it, so that
+// a - b - c groups as (a - b) - c.
+func (parser *Parser) rightOperand(operator infixOperator) (Expr, error) {
+	if operator.rightAssoc {
+		return parser.parsePrecedence(operator.precedence)
+	}
+	return parser.parsePrecedence(operator.precedence + 1)
+}
 
-		expr = newNode(operator, BINARY, expr, right)
+func (parser *Parser) prefix() (Expr, error) {
+	operandPrecedence, ok := prefixOperators[parser.peek().TokenType]
+	if !ok {
+		return parser.primary()
 	}
 
-	return expr, nil
+	operator := parser.advance()
+	expr, err := parser.parsePrecedence(operandPrecedence)
+	if err != nil {
+		return nil, err
+	}
+	span := scanner.JoinSpans(operator.Span, expr.Span())
+
+	if operator.TokenType == scanner.PLUS_PLUS || operator.TokenType == scanner.MINUS_MINUS {
+		if !isAssignable(expr) {
+			parser.error(operator, "Invalid increment target.")
+			return expr, nil
+		}
+		return withSpan(&IncrementExpr{Target: expr, Operator: operator, Prefix: true}, span), nil
+	}
+	return withSpan(&UnaryExpr{Operator: operator, Right: expr}, span), nil
 }
 
-func (parser *Parser) unary() (*Node, error) {
-	if parser.match(scanner.BANG, scanner.MINUS) {
-		operator := parser.previous()
-		expr, err := parser.unary()
+// infix builds the node for operator once it and its left operand have been
+// consumed.
+func (parser *Parser) infix(left Expr, operator scanner.Token, rule infixOperator) (Expr, error) {
+	switch rule.kind {
+	case postfixOp:
+		if !isAssignable(left) {
+			parser.error(operator, "Invalid increment target.")
+			return left, nil
+		}
+		return withSpan(&IncrementExpr{Target: left, Operator: operator, Prefix: false},
+			scanner.JoinSpans(left.Span(), operator.Span)), nil
+	case callOp:
+		return parser.finishCall(left)
+	case getOp:
+		name, err := parser.consume(scanner.IDENTIFIER, "Expect property name after '.'.")
 		if err != nil {
 			return nil, err
 		}
-		return newNode(operator, UNARY, nil, expr), nil
+		return withSpan(&GetExpr{Object: left, Name: name},
+			scanner.JoinSpans(left.Span(), name.Span)), nil
+	case indexOp:
+		index, err := parser.expression()
+		if err != nil {
+			return nil, err
+		}
+		bracket, err := parser.consume(scanner.RIGHT_BRACKET, "Expect ']' after index.")
+		if err != nil {
+			return nil, err
+		}
+		return withSpan(&IndexExpr{Object: left, Bracket: bracket, Index: index},
+			scanner.JoinSpans(left.Span(), bracket.Span)), nil
+	case conditionalOp:
+		return parser.conditional(left, operator, rule)
 	}
 
-	expr, err := parser.primary()
+	right, err := parser.rightOperand(rule)
+	if err != nil {
+		return nil, err
+	}
+	span := scanner.JoinSpans(left.Span(), right.Span())
+
+	switch rule.kind {
+	case logicalOp:
+		return withSpan(&LogicalExpr{Left: left, Operator: operator, Right: right}, span), nil
+	case assignOp:
+		return parser.assignment(left, operator, right, span), nil
+	case compoundAssignOp:
+		if !isAssignable(left) {
+			parser.error(operator, "Invalid assignment target.")
+			return left, nil
+		}
+		return withSpan(&CompoundAssignExpr{Target: left, Operator: operator, Value: right}, span), nil
+	}
+	return withSpan(&BinaryExpr{Left: left, Operator: operator, Right: right}, span), nil
+}
 
+// assignment turns the target of an '=' into the node that assigns to it.
+func (parser *Parser) assignment(target Expr, equal scanner.Token, value Expr, span scanner.Span) Expr {
+	switch t := target.(type) {
+	case *VariableExpr:
+		return withSpan(&AssignExpr{Name: t.Name, Value: value}, span)
+	case *GetExpr:
+		return withSpan(&SetExpr{Object: t.Object, Name: t.Name, Value: value}, span)
+	case *IndexExpr:
+		return withSpan(&IndexSetExpr{
+			Object:  t.Object,
+			Bracket: t.Bracket,
+			Index:   t.Index,
+			Value:   value,
+		}, span)
+	}
+	// reported, but the parser is not confused, so there is no need to unwind
+	parser.error(equal, "Invalid assignment target.")
+	return target
+}
+
+// isAssignable tells whether expr can be the target of a compound assignment
+// or an increment.
+func isAssignable(expr Expr) bool {
+	switch expr.(type) {
+	case *VariableExpr, *GetExpr, *IndexExpr:
+		return true
+	}
+	return false
+}
+
+// conditional parses the rest of "a ? b : c" once the '?' has been matched.
+// The then branch can be any expression, since it is closed by the ':'.
+func (parser *Parser) conditional(condition Expr, question scanner.Token, rule infixOperator) (Expr, error) {
+	thenBranch, err := parser.expression()
 	if err != nil {
 		return nil, err
 	}
-	return expr, nil
+
+	_, err = parser.consume(scanner.COLON, "Expect ':' after then branch of conditional expression.")
+	if err != nil {
+		return nil, err
+	}
+
+	elseBranch, err := parser.rightOperand(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	return withSpan(&ConditionalExpr{
+		Condition:  condition,
+		Question:   question,
+		ThenBranch: thenBranch,
+		ElseBranch: elseBranch,
+	}, scanner.JoinSpans(condition.Span(), elseBranch.Span())), nil
 }
 
-func (parser *Parser) primary() (*Node, error) {
+func (parser *Parser) finishCall(callee Expr) (Expr, error) {
+	var args []Expr
+
+	if !parser.check(scanner.RIGHT_PAREN) {
+		for {
+			if len(args) >= maxArgs {
+				errorHand.ParseError(parser.peek().Lexeme, parser.peek().Line,
+					"Can't have more than 255 arguments.")
+			}
+
+			arg, err := parser.expression()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+
+			if !parser.match(scanner.COMMA) {
+				break
+			}
+		}
+	}
+
+	paren, err := parser.consume(scanner.RIGHT_PAREN, "Expect ')' after arguments.")
+	if err != nil {
+		return nil, err
+	}
+
+	return withSpan(&CallExpr{Callee: callee, Paren: paren, Arguments: args},
+		scanner.JoinSpans(callee.Span(), paren.Span)), nil
+}
+
+func (parser *Parser) primary() (Expr, error) {
+	start := parser.peek()
 	if parser.match(scanner.TRUE) {
-		return newNode(parser.previous(), LITERAL, nil, nil), nil
+		return withSpan(&LiteralExpr{Token: start, Value: true}, start.Span), nil
 	}
 	if parser.match(scanner.FALSE) {
-		return newNode(parser.previous(), LITERAL, nil, nil), nil
+		return withSpan(&LiteralExpr{Token: start, Value: false}, start.Span), nil
+	}
+	if parser.match(scanner.STRING) {
+		return withSpan(&LiteralExpr{Token: start, Value: start.Literal}, start.Span), nil
 	}
-	if parser.match(scanner.STRING, scanner.NUMBER) {
-		return newNode(parser.previous(), LITERAL, nil, nil), nil
+	if parser.match(scanner.NUMBER) {
+		number, _ := strconv.ParseFloat(start.Literal, 64)
+		return withSpan(&LiteralExpr{Token: start, Value: number}, start.Span), nil
 	}
 	if parser.match(scanner.NIL) {
-		return newNode(parser.previous(), LITERAL, nil, nil), nil
+		return withSpan(&LiteralExpr{Token: start, Value: nil}, start.Span), nil
+	}
+	if parser.match(scanner.FUN) {
+		return parser.lambda()
+	}
+	if parser.match(scanner.LEFT_BRACKET) {
+		return parser.list()
+	}
+	if parser.match(scanner.LEFT_BRACE) {
+		return parser.mapLiteral()
+	}
+	if parser.check(scanner.LEFT_PAREN) && parser.isArrowFunction() {
+		return parser.arrowFunction()
 	}
 	if parser.match(scanner.LEFT_PAREN) {
-		thisTok := parser.previous()
 		expr, err := parser.expression()
 		if err != nil {
 			return nil, err
 		}
 
-		_, err = parser.consume(scanner.RIGHT_PAREN, "Expect ) after expression.")
+		_, err = parser.consume(scanner.RIGHT_PAREN, "Expect ')' after expression.")
 		if err != nil {
 			return nil, err
 		}
 
-		return newNode(thisTok, GROUPING, expr, nil), nil
+		return withSpan(&GroupingExpr{Expression: expr}, parser.spanFrom(start)), nil
+	}
+	if parser.match(scanner.THIS) {
+		keyword := parser.previous()
+		if parser.classDepth == 0 {
+			errorHand.ParseError(keyword.Lexeme, keyword.Line, "Can't use 'this' outside of a class.")
+		}
+		return withSpan(&ThisExpr{Keyword: keyword}, keyword.Span), nil
+	}
+	if parser.match(scanner.SUPER) {
+		keyword := parser.previous()
+		if parser.classDepth == 0 {
+			errorHand.ParseError(keyword.Lexeme, keyword.Line, "Can't use 'super' outside of a class.")
+		} else if !parser.inSubclass {
+			errorHand.ParseError(keyword.Lexeme, keyword.Line,
+				"Can't use 'super' in a class with no superclass.")
+		}
+
+		_, err := parser.consume(scanner.DOT, "Expect '.' after 'super'.")
+		if err != nil {
+			return nil, err
+		}
+		method, err := parser.consume(scanner.IDENTIFIER, "Expect superclass method name.")
+		if err != nil {
+			return nil, err
+		}
+		return withSpan(&SuperExpr{Keyword: keyword, Method: method}, parser.spanFrom(keyword)), nil
 	}
 	if parser.match(scanner.IDENTIFIER) {
-		return newNode(parser.previous(), VARIABLE, nil, nil), nil
+		return withSpan(&VariableExpr{Name: start}, start.Span), nil
+	}
+
+	return nil, parser.error(parser.peek(), "Expect expression.")
+}
+
+// list parses the elements of a list literal once the '[' has been matched.
+func (parser *Parser) list() (Expr, error) {
+	start := parser.previous()
+	var elements []Expr
+
+	if !parser.check(scanner.RIGHT_BRACKET) {
+		for {
+			element, err := parser.expression()
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+
+			if !parser.match(scanner.COMMA) {
+				break
+			}
+		}
+	}
+
+	_, err := parser.consume(scanner.RIGHT_BRACKET, "Expect ']' after list elements.")
+	if err != nil {
+		return nil, err
+	}
+	return withSpan(&ListExpr{Elements: elements}, parser.spanFrom(start)), nil
+}
+
+// mapLiteral parses the entries of a map literal once the '{' has been
+// matched.
+func (parser *Parser) mapLiteral() (Expr, error) {
+	start := parser.previous()
+	var keys, values []Expr
+
+	if !parser.check(scanner.RIGHT_BRACE) {
+		for {
+			key, err := parser.expression()
+			if err != nil {
+				return nil, err
+			}
+			_, err = parser.consume(scanner.COLON, "Expect ':' after map key.")
+			if err != nil {
+				return nil, err
+			}
+			value, err := parser.expression()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			values = append(values, value)
+
+			if !parser.match(scanner.COMMA) {
+				break
+			}
+		}
 	}
 
-	return nil, errors.New("Expect expression")
+	brace, err := parser.consume(scanner.RIGHT_BRACE, "Expect '}' after map entries.")
+	if err != nil {
+		return nil, err
+	}
+	return withSpan(&MapExpr{Brace: brace, Keys: keys, Values: values}, parser.spanFrom(start)), nil
+}
+
+// isMapLiteral tells a statement starting with a map literal, like
+// {"a": 1}, apart from a block. A string or number followed by ':' can't
+// start a statement inside a block.
+func (parser *Parser) isMapLiteral() bool {
+	if !parser.check(scanner.LEFT_BRACE) {
+		return false
+	}
+	key := parser.tokens[parser.current+1].TokenType
+	return (key == scanner.STRING || key == scanner.NUMBER) &&
+		parser.tokens[parser.current+2].TokenType == scanner.COLON
+}
+
+// lambda parses "fun (params) { body }" once the 'fun' has been matched.
+func (parser *Parser) lambda() (Expr, error) {
+	keyword := parser.previous()
+	_, err := parser.consume(scanner.LEFT_PAREN, "Expect '(' after 'fun'.")
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := parser.parameters()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = parser.consume(scanner.LEFT_BRACE, "Expect '{' before lambda body.")
+	if err != nil {
+		return nil, err
+	}
+
+	leave := parser.enterFunction(false)
+	body, err := parser.block()
+	leave()
+	if err != nil {
+		return nil, err
+	}
+
+	return withSpan(&FunctionExpr{Keyword: keyword, Params: params, Body: body}, parser.spanFrom(keyword)), nil
+}
+
+// isArrowFunction looks ahead, without consuming anything, for the
+// "(a, b) =>" that starts an arrow function.
+func (parser *Parser) isArrowFunction() bool {
+	i := parser.current + 1
+	if parser.tokens[i].TokenType != scanner.RIGHT_PAREN {
+		for {
+			if parser.tokens[i].TokenType != scanner.IDENTIFIER {
+				return false
+			}
+			i++
+			if parser.tokens[i].TokenType != scanner.COMMA {
+				break
+			}
+			i++
+		}
+	}
+	return parser.tokens[i].TokenType == scanner.RIGHT_PAREN &&
+		parser.tokens[i+1].TokenType == scanner.ARROW
+}
+
+// arrowFunction parses "(params) => expression", which returns the value
+// of the expression.
+func (parser *Parser) arrowFunction() (Expr, error) {
+	start := parser.advance()
+	params, err := parser.parameters()
+	if err != nil {
+		return nil, err
+	}
+	arrow := parser.advance()
+
+	leave := parser.enterFunction(false)
+	value, err := parser.expression()
+	leave()
+	if err != nil {
+		return nil, err
+	}
+
+	body := &ReturnStmt{Keyword: arrow, Value: value}
+	body.setSpan(value.Span())
+	return withSpan(&FunctionExpr{Keyword: arrow, Params: params, Body: []Statement{body}}, parser.spanFrom(start)), nil
 }
 
 func (parser *Parser) match(tokenType ...scanner.TokenType) bool {
@@ -406,8 +1438,51 @@ func (parser *Parser) consume(tokenType scanner.TokenType, message string) (scan
 	if parser.check(tokenType) {
 		return parser.advance(), nil
 	}
-	errorHand.Error(parser.previous().Line, message)
-	return scanner.Token{}, errors.New(message)
+	return scanner.Token{}, parser.error(parser.peek(), message)
+}
+
+// spanFrom returns the span from start up to the last consumed token.
+func (parser *Parser) spanFrom(start scanner.Token) scanner.Span {
+	return scanner.JoinSpans(start.Span, parser.previous().Span)
+}
+
+// withSpan sets the span of expr and hands it back, so building a node and
+// recording where it came from stays a single expression.
+func withSpan(expr Expr, span scanner.Span) Expr {
+	expr.setSpan(span)
+	return expr
+}
+
+// error reports a syntax error at token and returns an error the caller can
+// use to unwind to the enclosing declaration.
+func (parser *Parser) error(token scanner.Token, message string) error {
+	if token.TokenType == scanner.EOF {
+		errorHand.ParseError("", token.Line, message)
+	} else {
+		errorHand.ParseError(token.Lexeme, token.Line, message)
+	}
+	return errors.New(message)
+}
+
+// synchronize discards tokens until it reaches what is probably the start of
+// the next statement, so one syntax error does not cascade into many.
+func (parser *Parser) synchronize() {
+	parser.advance()
+
+	for !parser.isAtEnd() {
+		if parser.previous().TokenType == scanner.SEMICOLON {
+			return
+		}
+
+		switch parser.peek().TokenType {
+		case scanner.CLASS, scanner.FUN, scanner.VAR, scanner.CONST, scanner.FOR,
+			scanner.IF, scanner.WHILE, scanner.PRINT, scanner.RETURN, scanner.BREAK,
+			scanner.CONTINUE, scanner.SWITCH, scanner.CASE, scanner.DEFAULT:
+			return
+		}
+
+		parser.advance()
+	}
 }
 
 func (parser *Parser) advance() scanner.Token {
@@ -433,6 +1508,14 @@ func (parser *Parser) check(tokenType scanner.TokenType) bool {
 	return parser.peek().TokenType == tokenType
 }
 
+// checkNext looks one token past the current one.
+func (parser *Parser) checkNext(tokenType scanner.TokenType) bool {
+	if parser.isAtEnd() {
+		return false
+	}
+	return parser.tokens[parser.current+1].TokenType == tokenType
+}
+
 func (parser Parser) isAtEnd() bool {
 	return parser.tokens[parser.current].TokenType == scanner.EOF
 }
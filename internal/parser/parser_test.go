@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/interpreter-starter-go/internal/errorHand"
+	"github.com/codecrafters-io/interpreter-starter-go/internal/scanner"
+)
+
+// parseExpr parses source as a single expression and returns its AstPrint
+// form, or "" with ok false if it had a syntax error.
+func parseExpr(t *testing.T, source string) (string, bool) {
+	t.Helper()
+	errorHand.HadError = false
+	defer func() {
+		errorHand.HadError = false
+	}()
+
+	tokens := scanner.NewScanner([]byte(source)).Scan([]byte(source))
+	parser := NewParser(tokens)
+	expr := parser.ParseExpr()
+	if errorHand.HadError || expr == nil {
+		return "", false
+	}
+	if !parser.isAtEnd() {
+		t.Fatalf("%q: parsing stopped at %q", source, parser.peek().Lexeme)
+	}
+	return stringify(expr), true
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		// assignment is the loosest and right associative
+		{"assign chain", "a = b = c", "(assign a (assign b c))"},
+		{"assign takes conditional", "a = b ? c : d", "(assign a (?: b c d))"},
+		{"assign takes or", "a = b or c", "(assign a (or b c))"},
+		{"compound assign chain", "a += b -= c", "(+= a (-= b c))"},
+		{"compound assign takes sum", "a *= b + c", "(*= a (+ b c))"},
+		{"slash assign", "a /= b", "(/= a b)"},
+		{"set", "a.b = c", "(set a b c)"},
+		{"index set", "a[0] = b", "(index-set a 0.0 b)"},
+
+		// conditional is right associative and looser than or
+		{"conditional chain", "a ? b : c ? d : e", "(?: a b (?: c d e))"},
+		{"conditional takes or", "a or b ? c : d", "(?: (or a b) c d)"},
+		{"conditional then branch", "a ? b = c : d", "(?: a (assign b c) d)"},
+
+		// logical operators are left associative, and binds tighter than or
+		{"or chain", "a or b or c", "(or (or a b) c)"},
+		{"and chain", "a and b and c", "(and (and a b) c)"},
+		{"and inside or", "a or b and c", "(or a (and b c))"},
+		{"and before or", "a and b or c", "(or (and a b) c)"},
+		{"and takes equality", "a == b and c", "(and (== a b) c)"},
+
+		// comparison binds tighter than equality
+		{"comparison inside equality", "1 < 2 == true", "(== (< 1.0 2.0) true)"},
+		{"equality after comparison", "true != 1 >= 2", "(!= true (>= 1.0 2.0))"},
+		{"equality chain", "a == b != c", "(!= (== a b) c)"},
+		{"comparison chain", "a < b <= c > d >= e", "(>= (> (<= (< a b) c) d) e)"},
+		{"comparison takes sum", "1 + 2 < 3 - 4", "(< (+ 1.0 2.0) (- 3.0 4.0))"},
+
+		// term and factor are left associative
+		{"term chain", "1 - 2 + 3", "(+ (- 1.0 2.0) 3.0)"},
+		{"factor inside term", "1 + 2 * 3", "(+ 1.0 (* 2.0 3.0))"},
+		{"factor before term", "1 * 2 - 3", "(- (* 1.0 2.0) 3.0)"},
+		{"factor chain", "1 * 2 / 3 % 4", "(% (/ (* 1.0 2.0) 3.0) 4.0)"},
+
+		// unary is looser than power, which is right associative
+		{"unary inside factor", "-a * b", "(* (- a) b)"},
+		{"not inside equality", "!a == b", "(== (! a) b)"},
+		{"nested unary", "!-a", "(! (- a))"},
+		{"power inside unary", "-2 ** 2", "(- (** 2.0 2.0))"},
+		{"power chain", "2 ** 3 ** 2", "(** 2.0 (** 3.0 2.0))"},
+		{"unary exponent", "2 ** -1", "(** 2.0 (- 1.0))"},
+		{"power inside factor", "2 * 3 ** 2", "(* 2.0 (** 3.0 2.0))"},
+
+		// increments are tighter than power, calls tighter still
+		{"prefix increment before power", "++a ** 2", "(** (pre++ a) 2.0)"},
+		{"postfix increment before power", "a++ ** 2", "(** (post++ a) 2.0)"},
+		{"postfix inside unary", "-a--", "(- (post-- a))"},
+		{"prefix increment of field", "--a.b", "(pre-- (get a b))"},
+		{"postfix increment of index", "a[0]++", "(post++ (index a 0.0))"},
+
+		{"call chain", "a.b(c)[d]", "(index (call (get a b) c) d)"},
+		{"call inside unary", "-f(x)", "(- (call f x))"},
+		{"grouping", "(1 + 2) * 3", "(* (group (+ 1.0 2.0)) 3.0)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseExpr(t, tt.source)
+			if !ok {
+				t.Fatalf("%q: unexpected syntax error", tt.source)
+			}
+			if got != tt.want {
+				t.Errorf("%q: got %s, want %s", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidTargets(t *testing.T) {
+	tests := []string{
+		"a + b = c",
+		"!a = b",
+		"a ? b : c = d",
+		"a() = b",
+		"1 += 2",
+		"++1",
+		"a()++",
+		"++a++",
+	}
+
+	for _, source := range tests {
+		t.Run(source, func(t *testing.T) {
+			if got, ok := parseExpr(t, source); ok {
+				t.Errorf("%q: want a syntax error, got %s", source, got)
+			}
+		})
+	}
+}
+
+// TestPrintASTJSONLarge guards against encoding subtrees once per ancestor,
+// which made long and deeply nested expressions take minutes.
+func TestPrintASTJSONLarge(t *testing.T) {
+	tests := map[string]string{
+		"long": "print " + strings.Repeat("1 + ", 1000) + "1;",
+		"deep": "print " + strings.Repeat("(", 1000) + "1" + strings.Repeat(")", 1000) + ";",
+	}
+
+	for name, source := range tests {
+		t.Run(name, func(t *testing.T) {
+			errorHand.HadError = false
+			defer func() {
+				errorHand.HadError = false
+			}()
+
+			tokens := scanner.NewScanner([]byte(source)).Scan([]byte(source))
+			parser := NewParser(tokens)
+			stmts := parser.ParseStmts()
+			if errorHand.HadError {
+				t.Fatal("unexpected syntax error")
+			}
+
+			var out bytes.Buffer
+			err := PrintASTJSON(&out, stmts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !json.Valid(out.Bytes()) {
+				t.Fatal("output is not valid JSON")
+			}
+			if got := strings.Count(out.String(), `"kind": "LiteralExpr"`); got != strings.Count(source, "1") {
+				t.Errorf("got %d literals, want %d", got, strings.Count(source, "1"))
+			}
+		})
+	}
+}
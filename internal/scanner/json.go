@@ -0,0 +1,73 @@
+package scanner
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSONVersion is the version of the JSON schema the tokenize and parse
+// commands emit with --format=json. It goes up whenever a field or node kind
+// is renamed or removed; adding new ones keeps it. The schema is described
+// in docs/json-format.md.
+const JSONVersion = 1
+
+type positionJSON struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type SpanJSON struct {
+	Start positionJSON `json:"start"`
+	End   positionJSON `json:"end"`
+}
+
+type tokenJSON struct {
+	Type    string   `json:"type"`
+	Lexeme  string   `json:"lexeme"`
+	Literal *string  `json:"literal"`
+	Line    int      `json:"line"`
+	Column  int      `json:"column"`
+	Span    SpanJSON `json:"span"`
+}
+
+// ToJSON converts a span to its JSON form.
+func (span Span) ToJSON() SpanJSON {
+	return SpanJSON{
+		Start: positionJSON(span.Start),
+		End:   positionJSON(span.End),
+	}
+}
+
+// WriteJSON encodes v as indented JSON without escaping <, > and &, which
+// are common in Lox operators.
+func WriteJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// PrintTokensJSON is the --format=json version of PrintTokens.
+func PrintTokensJSON(w io.Writer, tokens []Token) error {
+	out := struct {
+		Version int         `json:"version"`
+		Tokens  []tokenJSON `json:"tokens"`
+	}{Version: JSONVersion, Tokens: make([]tokenJSON, len(tokens))}
+
+	for i, token := range tokens {
+		var literal *string = nil
+		if token.TokenType == STRING || token.TokenType == NUMBER {
+			literal = &tokens[i].Literal
+		}
+		out.Tokens[i] = tokenJSON{
+			Type:    token.TokenType.String(),
+			Lexeme:  token.Lexeme,
+			Literal: literal,
+			Line:    token.Span.Start.Line,
+			Column:  token.Span.Start.Column,
+			Span:    token.Span.ToJSON(),
+		}
+	}
+	return WriteJSON(w, out)
+}
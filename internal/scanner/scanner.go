@@ -14,6 +14,8 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	QUESTION_MARK
 	COMMA
 	DOT
@@ -23,6 +25,7 @@ const (
 	COLON
 	SLASH
 	STAR
+	PERCENT
 	// one or two character tokens
 	BANG
 	BANG_EQUAL
@@ -32,13 +35,26 @@ const (
 	GREATER_EQUAL
 	LESS
 	LESS_EQUAL
+	ARROW
+	PLUS_EQUAL
+	MINUS_EQUAL
+	STAR_EQUAL
+	SLASH_EQUAL
+	PLUS_PLUS
+	MINUS_MINUS
+	STAR_STAR
 	// literals
 	IDENTIFIER
 	STRING
 	NUMBER
 	// keywords
 	AND
+	BREAK
+	CASE
 	CLASS
+	CONST
+	CONTINUE
+	DEFAULT
 	ELSE
 	FALSE
 	FUN
@@ -49,6 +65,7 @@ const (
 	PRINT
 	RETURN
 	SUPER
+	SWITCH
 	THIS
 	TRUE
 	VAR
@@ -58,13 +75,34 @@ const (
 )
 
 func (tokenType TokenType) String() string {
-	return [42]string{
-		"LEFT_PAREN", "RIGHT_PAREN", "LEFT_BRACE", "RIGHT_BRACE", "QUESTION_MARK",
-		"COMMA", "DOT", "MINUS", "PLUS", "SEMICOLON", "COLON", "SLASH", "STAR", "BANG",
+	return [59]string{
+		"LEFT_PAREN", "RIGHT_PAREN", "LEFT_BRACE", "RIGHT_BRACE", "LEFT_BRACKET",
+		"RIGHT_BRACKET", "QUESTION_MARK",
+		"COMMA", "DOT", "MINUS", "PLUS", "SEMICOLON", "COLON", "SLASH", "STAR", "PERCENT", "BANG",
 		"BANG_EQUAL", "EQUAL", "EQUAL_EQUAL", "GREATER", "GREATER_EQUAL", "LESS",
-		"LESS_EQUAL", "IDENTIFIER", "STRING", "NUMBER", "AND", "CLASS", "ELSE", "FALSE",
-		"FUN", "FOR", "IF", "NIL", "OR", "PRINT", "RETURN", "SUPER", "THIS", "TRUE", "VAR",
-		"WHILE", "EOF"}[tokenType]
+		"LESS_EQUAL", "ARROW", "PLUS_EQUAL", "MINUS_EQUAL", "STAR_EQUAL", "SLASH_EQUAL",
+		"PLUS_PLUS", "MINUS_MINUS", "STAR_STAR", "IDENTIFIER", "STRING", "NUMBER", "AND", "BREAK",
+		"CASE", "CLASS", "CONST", "CONTINUE", "DEFAULT", "ELSE", "FALSE", "FUN", "FOR", "IF", "NIL", "OR",
+		"PRINT", "RETURN", "SUPER", "SWITCH", "THIS", "TRUE", "VAR", "WHILE", "EOF"}[tokenType]
+}
+
+// Position is a point in the source: a byte offset plus the 1-based line and
+// column (counted in bytes) it falls on.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Span is the source range from Start up to, but not including, End.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// JoinSpans returns the span going from the start of first to the end of last.
+func JoinSpans(first, last Span) Span {
+	return Span{Start: first.Start, End: last.End}
 }
 
 type Token struct {
@@ -72,48 +110,59 @@ type Token struct {
 	Lexeme    string
 	Literal   string
 	TokenType TokenType
+	Span      Span
 }
 
 type Scanner struct {
-	source  []byte
-	tokens  []Token
-	start   int
-	current int
-	line    int
+	source    []byte
+	tokens    []Token
+	start     int
+	current   int
+	line      int
+	lineStart int
+	startPos  Position
 }
 
 func NewScanner(sourceString []byte) *Scanner {
 	return &Scanner{
-		source:  sourceString,
-		tokens:  make([]Token, 0),
-		start:   0,
-		current: 0,
-		line:    1,
+		source:    sourceString,
+		tokens:    make([]Token, 0),
+		start:     0,
+		current:   0,
+		line:      1,
+		lineStart: 0,
 	}
 }
 
 var keyWords map[string]TokenType = map[string]TokenType{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"fun":    FUN,
-	"for":    FOR,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
+	"and":      AND,
+	"break":    BREAK,
+	"case":     CASE,
+	"class":    CLASS,
+	"const":    CONST,
+	"continue": CONTINUE,
+	"default":  DEFAULT,
+	"else":     ELSE,
+	"false":    FALSE,
+	"fun":      FUN,
+	"for":      FOR,
+	"if":       IF,
+	"nil":      NIL,
+	"or":       OR,
+	"print":    PRINT,
+	"return":   RETURN,
+	"super":    SUPER,
+	"switch":   SWITCH,
+	"this":     THIS,
+	"true":     TRUE,
+	"var":      VAR,
+	"while":    WHILE,
 }
 
 func (scan *Scanner) Scan(sourceInput []byte) []Token {
 	for !scan.isAtEnd() {
 		scan.start = scan.current
+		scan.startPos = scan.position()
 		scan.scanTokens()
 	}
 	eofToken := Token{
@@ -121,6 +170,7 @@ func (scan *Scanner) Scan(sourceInput []byte) []Token {
 		TokenType: EOF,
 		Lexeme:    "",
 		Literal:   "null",
+		Span:      Span{Start: scan.position(), End: scan.position()},
 	}
 	scan.tokens = append(scan.tokens, eofToken)
 	return scan.tokens
@@ -138,23 +188,53 @@ func (scan *Scanner) scanTokens() {
 		scan.addToken(LEFT_PAREN)
 	case ')':
 		scan.addToken(RIGHT_PAREN)
+	case '[':
+		scan.addToken(LEFT_BRACKET)
+	case ']':
+		scan.addToken(RIGHT_BRACKET)
 	case ',':
 		scan.addToken(COMMA)
 	case '.':
 		scan.addToken(DOT)
 	case '-':
-		scan.addToken(MINUS)
+		if scan.match('=') {
+			scan.addToken(MINUS_EQUAL)
+		} else if scan.match('-') {
+			scan.addToken(MINUS_MINUS)
+		} else {
+			scan.addToken(MINUS)
+		}
 	case '+':
-		scan.addToken(PLUS)
+		if scan.match('=') {
+			scan.addToken(PLUS_EQUAL)
+		} else if scan.match('+') {
+			scan.addToken(PLUS_PLUS)
+		} else {
+			scan.addToken(PLUS)
+		}
 	case ';':
 		scan.addToken(SEMICOLON)
 	case '*':
-		scan.addToken(STAR)
+		if scan.match('=') {
+			scan.addToken(STAR_EQUAL)
+		} else if scan.match('*') {
+			scan.addToken(STAR_STAR)
+		} else {
+			scan.addToken(STAR)
+		}
+	case '%':
+		scan.addToken(PERCENT)
+	case '?':
+		scan.addToken(QUESTION_MARK)
+	case ':':
+		scan.addToken(COLON)
 	case '\n':
-		scan.line++
+		scan.newLine()
 	case '=':
 		if scan.match('=') {
 			scan.addToken(EQUAL_EQUAL)
+		} else if scan.match('>') {
+			scan.addToken(ARROW)
 		} else {
 			scan.addToken(EQUAL)
 		}
@@ -181,6 +261,8 @@ func (scan *Scanner) scanTokens() {
 			for !scan.isAtEnd() && scan.peek() != '\n' {
 				scan.advance()
 			}
+		} else if scan.match('=') {
+			scan.addToken(SLASH_EQUAL)
 		} else {
 			scan.addToken(SLASH)
 		}
@@ -213,10 +295,9 @@ func PrintTokens(tokens []Token) {
 
 func (scan *Scanner) scanString() {
 	for !scan.isAtEnd() && scan.peek() != '"' {
-		if scan.peek() == '\n' {
-			(*scan).line++
+		if scan.advance() == '\n' {
+			scan.newLine()
 		}
-		scan.advance()
 	}
 	if scan.isAtEnd() {
 		errorHand.Error(scan.line, "Unterminated string.")
@@ -296,11 +377,27 @@ func (scan *Scanner) addTokenWithLiteral(tokenType TokenType, literal string) {
 		Lexeme:    lexeme,
 		TokenType: tokenType,
 		Literal:   literal,
+		Span:      Span{Start: scan.startPos, End: scan.position()},
 	}
 
 	scan.tokens = append(scan.tokens, tok)
 }
 
+// newLine is called right after consuming a '\n'.
+func (scan *Scanner) newLine() {
+	scan.line++
+	scan.lineStart = scan.current
+}
+
+// position returns where the scanner is right now.
+func (scan *Scanner) position() Position {
+	return Position{
+		Offset: scan.current,
+		Line:   scan.line,
+		Column: scan.current - scan.lineStart + 1,
+	}
+}
+
 func isDigit(c byte) bool {
 	return c >= '0' && c <= '9'
 }